@@ -0,0 +1,241 @@
+package phpnginx
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// defaultAccessLogFormat is the access log format in effect when
+// $BP_PHP_NGINX_ACCESS_LOG_FORMAT is not set.
+const defaultAccessLogFormat = "extended"
+
+// customAccessLogFormat is the name of the log_format defined for a format
+// string given in $BP_PHP_NGINX_ACCESS_LOG_FORMAT.
+const customAccessLogFormat = "custom"
+
+// accessLogFormats are the formats that can be selected by name. combined
+// is predefined by Nginx; the others are defined in the template.
+var accessLogFormats = []string{"common", "combined", "extended", "json"}
+
+// NginxAccessLog is the format of the access log written to stdout, and the
+// requests left out of it.
+type NginxAccessLog struct {
+	// Off turns the access log off.
+	Off bool
+
+	// Format is the name of the log_format used by access_log.
+	Format string
+
+	// Custom, when set, is the format string of the "custom" log_format,
+	// escaped for a single-quoted Nginx string.
+	Custom string
+
+	// ExcludePaths are the path prefixes, ExcludeUserAgents the
+	// case-insensitive user agent patterns and ExcludeStatuses the status
+	// codes or classes, such as "2xx", of the requests that are not logged.
+	ExcludePaths      []string
+	ExcludeUserAgents []string
+	ExcludeStatuses   []string
+
+	// SampleRate, when set, is the percentage of the remaining requests with
+	// a status below 400 that are logged, e.g. "10%".
+	SampleRate string
+}
+
+// Filtered reports whether some requests are left out of the access log, in
+// which case access_log is conditioned on $loggable.
+func (l NginxAccessLog) Filtered() bool {
+	return len(l.ExcludePaths) > 0 || len(l.ExcludeUserAgents) > 0 || len(l.ExcludeStatuses) > 0 || l.SampleRate != ""
+}
+
+// Maps returns the map blocks that set $loggable to 0 for the requests left
+// out of the access log. Each filter sets a variable of its own to 0 for the
+// requests it matches, and $loggable is 0 when any of them is.
+func (l NginxAccessLog) Maps() []NginxMap {
+	if l.Off || !l.Filtered() {
+		return nil
+	}
+
+	var (
+		maps      []NginxMap
+		variables string
+	)
+	add := func(source, variable string, entries []NginxMapEntry) {
+		maps = append(maps, NginxMap{
+			Source:   source,
+			Variable: variable,
+			Entries:  append([]NginxMapEntry{{Key: "default", Value: "1"}}, entries...),
+		})
+		variables += variable
+	}
+
+	if len(l.ExcludePaths) > 0 {
+		var entries []NginxMapEntry
+		for _, prefix := range l.ExcludePaths {
+			entries = append(entries, NginxMapEntry{Key: quoteMapKey("~^" + regexp.QuoteMeta(prefix)), Value: "0"})
+		}
+		add("$uri", "$access_log_path", entries)
+	}
+
+	if len(l.ExcludeUserAgents) > 0 {
+		var entries []NginxMapEntry
+		for _, pattern := range l.ExcludeUserAgents {
+			entries = append(entries, NginxMapEntry{Key: quoteMapKey("~*" + pattern), Value: "0"})
+		}
+		add("$http_user_agent", "$access_log_user_agent", entries)
+	}
+
+	if len(l.ExcludeStatuses) > 0 {
+		var entries []NginxMapEntry
+		for _, status := range l.ExcludeStatuses {
+			key := status
+			if class, ok := strings.CutSuffix(status, "xx"); ok {
+				key = "~^" + class
+			}
+			entries = append(entries, NginxMapEntry{Key: key, Value: "0"})
+		}
+		add("$status", "$access_log_status", entries)
+	}
+
+	if l.SampleRate != "" {
+		// $access_log_sampled is set by the split_clients block in the
+		// template, since map cannot pick a share of the requests.
+		maps = append(maps, NginxMap{
+			Source:   "$status",
+			Variable: "$access_log_sample",
+			Entries: []NginxMapEntry{
+				{Key: "default", Value: "$access_log_sampled"},
+				{Key: "~^[45]", Value: "1"},
+			},
+		})
+		variables += "$access_log_sample"
+	}
+
+	return append(maps, NginxMap{
+		Source:   quoteMapKey(variables),
+		Variable: "$loggable",
+		Entries: []NginxMapEntry{
+			{Key: "default", Value: "1"},
+			{Key: "~0", Value: "0"},
+		},
+	})
+}
+
+// LoadAccessLog returns the access log configured through
+// $BP_PHP_NGINX_ENABLE_ACCESS_LOG, $BP_PHP_NGINX_ACCESS_LOG_FORMAT, which is
+// either the name of a built-in format or a format string with at least one
+// variable, and the $BP_PHP_NGINX_ACCESS_LOG_EXCLUDE_* and
+// $BP_PHP_NGINX_ACCESS_LOG_SAMPLE_RATE filters.
+func LoadAccessLog() (NginxAccessLog, error) {
+	if value, ok := os.LookupEnv("BP_PHP_NGINX_ENABLE_ACCESS_LOG"); ok {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return NginxAccessLog{}, fmt.Errorf("failed to parse $BP_PHP_NGINX_ENABLE_ACCESS_LOG into boolean: %w", err)
+		}
+		if !enabled {
+			return NginxAccessLog{Off: true}, nil
+		}
+	}
+
+	log, err := loadAccessLogFormat()
+	if err != nil {
+		return NginxAccessLog{}, err
+	}
+
+	log.ExcludePaths = splitList(os.Getenv("BP_PHP_NGINX_ACCESS_LOG_EXCLUDE_PATHS"))
+	for _, prefix := range log.ExcludePaths {
+		if !strings.HasPrefix(prefix, "/") {
+			return NginxAccessLog{}, fmt.Errorf("failed to parse $BP_PHP_NGINX_ACCESS_LOG_EXCLUDE_PATHS: %q must be a path starting with \"/\"", prefix)
+		}
+	}
+
+	// User agents contain spaces, so the patterns are only separated by
+	// commas.
+	for _, pattern := range strings.Split(os.Getenv("BP_PHP_NGINX_ACCESS_LOG_EXCLUDE_USER_AGENTS"), ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			log.ExcludeUserAgents = append(log.ExcludeUserAgents, pattern)
+		}
+	}
+	for _, pattern := range log.ExcludeUserAgents {
+		// Nginx uses PCRE, whose syntax is a superset of Go's for the
+		// patterns that matter here, so this catches most typos.
+		if _, err := regexp.Compile(pattern); err != nil {
+			return NginxAccessLog{}, fmt.Errorf("failed to parse $BP_PHP_NGINX_ACCESS_LOG_EXCLUDE_USER_AGENTS: %q is not a regular expression", pattern)
+		}
+	}
+
+	log.ExcludeStatuses = splitList(os.Getenv("BP_PHP_NGINX_ACCESS_LOG_EXCLUDE_STATUSES"))
+	for _, status := range log.ExcludeStatuses {
+		if !statusPattern.MatchString(status) {
+			return NginxAccessLog{}, fmt.Errorf("failed to parse $BP_PHP_NGINX_ACCESS_LOG_EXCLUDE_STATUSES: %q is not a status code, such as 404, or class, such as 2xx", status)
+		}
+	}
+
+	if value, ok := os.LookupEnv("BP_PHP_NGINX_ACCESS_LOG_SAMPLE_RATE"); ok {
+		log.SampleRate, err = parseSampleRate(value)
+		if err != nil {
+			return NginxAccessLog{}, fmt.Errorf("failed to parse $BP_PHP_NGINX_ACCESS_LOG_SAMPLE_RATE: %w", err)
+		}
+	}
+
+	return log, nil
+}
+
+// statusPattern matches a status code or a class of status codes.
+var statusPattern = regexp.MustCompile(`^[1-5](xx|[0-9]{2})$`)
+
+func loadAccessLogFormat() (NginxAccessLog, error) {
+	value, ok := os.LookupEnv("BP_PHP_NGINX_ACCESS_LOG_FORMAT")
+	if !ok || strings.TrimSpace(value) == "" {
+		return NginxAccessLog{Format: defaultAccessLogFormat}, nil
+	}
+
+	for _, name := range accessLogFormats {
+		if strings.TrimSpace(value) == name {
+			return NginxAccessLog{Format: name}, nil
+		}
+	}
+
+	if !strings.Contains(value, "$") {
+		return NginxAccessLog{}, fmt.Errorf("failed to parse $BP_PHP_NGINX_ACCESS_LOG_FORMAT: %q is neither one of %s nor a format string with Nginx variables", value, strings.Join(accessLogFormats, ", "))
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return NginxAccessLog{}, fmt.Errorf("failed to parse $BP_PHP_NGINX_ACCESS_LOG_FORMAT: the format string must be a single line")
+	}
+
+	escaped := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+
+	return NginxAccessLog{Format: customAccessLogFormat, Custom: escaped}, nil
+}
+
+// parseSampleRate parses a percentage, with or without the "%", into the
+// form split_clients accepts. A rate of 100% samples nothing out and is
+// returned as an empty string.
+func parseSampleRate(value string) (string, error) {
+	trimmed := strings.TrimSuffix(strings.TrimSpace(value), "%")
+
+	rate, err := strconv.ParseFloat(trimmed, 64)
+	if err != nil || rate <= 0 || rate > 100 {
+		return "", fmt.Errorf("%q is not a percentage between 0 and 100, such as 10%%", value)
+	}
+
+	// split_clients only accepts two decimal places.
+	if _, decimals, ok := strings.Cut(trimmed, "."); ok && len(decimals) > 2 {
+		return "", fmt.Errorf("%q has more than two decimal places", value)
+	}
+
+	if rate == 100 {
+		return "", nil
+	}
+
+	return trimmed + "%", nil
+}
+
+// quoteMapKey quotes a map key or source so that Nginx reads it as a single
+// string, whatever characters it contains.
+func quoteMapKey(key string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(key) + `"`
+}
@@ -0,0 +1,245 @@
+package phpnginx
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultClientMaxBodySize is Nginx's own client_max_body_size, in effect
+// when $BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE is not set.
+const defaultClientMaxBodySize = "1m"
+
+// NginxBodySizeLocation sets the request body size limit for the requests
+// under a path prefix that is not served by a pool of its own.
+type NginxBodySizeLocation struct {
+	PathPrefix  string
+	MaxBodySize string
+
+	// Upstream and Timeout are those of the FPM pool that serves the path
+	// prefix.
+	Upstream string
+	Timeout  string
+}
+
+// LoadClientMaxBodySize returns the request body size limit of
+// $BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE, or an empty string when it is not set.
+func LoadClientMaxBodySize() (string, error) {
+	value, ok := os.LookupEnv("BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE")
+	if !ok {
+		return "", nil
+	}
+
+	size, err := parseBodySize(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse $BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE: %w", err)
+	}
+
+	return size, nil
+}
+
+// LoadBodySizeLocations parses $BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE_LOCATIONS,
+// a list of <path>=<size> pairs. A path that is the prefix of an additional
+// FPM pool sets the limit of that pool's location. Any other path gets a
+// location of its own, which passes requests to the pool whose prefix
+// contains it, or to the www pool with the given request timeout. Since the
+// limit only applies to PHP scripts through a PHP location nested in that
+// location, the template repeats the server's regular expression locations
+// ahead of it, so that presets' restrictions still apply under the path.
+func LoadBodySizeLocations(pools []FpmPool, requestTimeout time.Duration) ([]NginxBodySizeLocation, error) {
+	var locations []NginxBodySizeLocation
+	seen := map[string]bool{}
+	for _, entry := range splitList(os.Getenv("BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE_LOCATIONS")) {
+		path, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("failed to parse $BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE_LOCATIONS: %q is not a <path>=<size> pair", entry)
+		}
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("failed to parse $BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE_LOCATIONS: %q must be a path starting with \"/\"", path)
+		}
+
+		size, err := parseBodySize(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse $BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE_LOCATIONS: %w", err)
+		}
+
+		prefix := strings.TrimSuffix(path, "/") + "/"
+		if prefix == "/" {
+			return nil, fmt.Errorf("failed to parse $BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE_LOCATIONS: %q is the whole site, whose limit is set through $BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE", path)
+		}
+		if seen[prefix] {
+			return nil, fmt.Errorf("failed to parse $BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE_LOCATIONS: %q is listed more than once", path)
+		}
+		seen[prefix] = true
+
+		location := NginxBodySizeLocation{
+			PathPrefix:  prefix,
+			MaxBodySize: size,
+			Upstream:    "php_fpm",
+			Timeout:     formatTimeout(requestTimeout),
+		}
+
+		var pool *FpmPool
+		for i := range pools {
+			if strings.HasPrefix(prefix, pools[i].PathPrefix) && (pool == nil || len(pools[i].PathPrefix) > len(pool.PathPrefix)) {
+				pool = &pools[i]
+			}
+		}
+
+		if pool != nil && pool.PathPrefix == prefix {
+			pool.MaxBodySize = size
+			continue
+		}
+		if pool != nil {
+			location.Upstream = pool.Upstream()
+			location.Timeout = pool.Timeout()
+		}
+
+		locations = append(locations, location)
+	}
+
+	return locations, nil
+}
+
+// parseBodySize checks that value is a size Nginx accepts for
+// client_max_body_size, where 0 disables the limit.
+func parseBodySize(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if _, ok := parseSize(value); !ok {
+		return "", fmt.Errorf("%q is not a size such as 100m", value)
+	}
+
+	return value, nil
+}
+
+// phpUploadSetting is a PHP setting that limits the size of the requests
+// PHP accepts.
+type phpUploadSetting struct {
+	Name  string
+	Value string
+}
+
+// loadPhpUploadSettings returns PHP's post_max_size and upload_max_filesize
+// as set in the PHP buildpack's php.ini ($PHPRC), the directories in
+// $PHP_INI_SCAN_DIR and the application's .php.ini.d directory, read in the
+// order PHP reads them so that later files win. Settings that none of the
+// files set are left out, and files that cannot be read are skipped.
+func loadPhpUploadSettings(workingDir string) []phpUploadSetting {
+	var files []string
+	if phprc := os.Getenv("PHPRC"); phprc != "" {
+		if info, err := os.Stat(phprc); err == nil && info.IsDir() {
+			phprc = filepath.Join(phprc, "php.ini")
+		}
+		files = append(files, phprc)
+	}
+
+	dirs := filepath.SplitList(os.Getenv("PHP_INI_SCAN_DIR"))
+	dirs = append(dirs, filepath.Join(workingDir, ".php.ini.d"))
+
+	seen := map[string]bool{}
+	for _, dir := range dirs {
+		if dir == "" || seen[filepath.Clean(dir)] {
+			continue
+		}
+		seen[filepath.Clean(dir)] = true
+
+		matches, _ := filepath.Glob(filepath.Join(dir, "*.ini"))
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+
+	settings := []phpUploadSetting{{Name: "post_max_size"}, {Name: "upload_max_filesize"}}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		for scanner.Scan() {
+			name, value, ok := strings.Cut(scanner.Text(), "=")
+			if !ok {
+				continue
+			}
+
+			for i := range settings {
+				if settings[i].Name == strings.TrimSpace(name) {
+					value, _, _ = strings.Cut(value, ";")
+					settings[i].Value = strings.Trim(strings.TrimSpace(value), `"'`)
+				}
+			}
+		}
+	}
+
+	var found []phpUploadSetting
+	for _, setting := range settings {
+		if setting.Value != "" {
+			found = append(found, setting)
+		}
+	}
+
+	return found
+}
+
+// checkUploadSizes warns when Nginx rejects request bodies that PHP would
+// accept, so that uploads fail with a 413 before they reach PHP. The largest
+// limit among the server and the body size locations is compared, since
+// uploads usually go to dedicated paths.
+func (c NginxConfigWriter) checkUploadSizes(workingDir string, data NginxConfig) {
+	limit := data.ClientMaxBodySize
+	if limit == "" {
+		limit = defaultClientMaxBodySize
+	}
+
+	sizes := []string{limit}
+	for _, pool := range data.FpmPools {
+		if pool.MaxBodySize != "" {
+			sizes = append(sizes, pool.MaxBodySize)
+		}
+	}
+	for _, location := range data.BodySizeLocations {
+		sizes = append(sizes, location.MaxBodySize)
+	}
+
+	var largest uint64
+	for _, size := range sizes {
+		parsed, _ := parseSize(size)
+		if parsed == 0 {
+			// client_max_body_size 0 disables the limit
+			return
+		}
+		if parsed > largest {
+			largest, limit = parsed, size
+		}
+	}
+
+	var (
+		smaller  []string
+		required string
+		maximum  uint64
+	)
+	for _, setting := range loadPhpUploadSettings(workingDir) {
+		parsed, ok := parseSize(setting.Value)
+		if !ok || parsed == 0 || parsed <= largest {
+			continue
+		}
+
+		smaller = append(smaller, fmt.Sprintf("%s (%s)", setting.Name, setting.Value))
+		if parsed > maximum {
+			required, maximum = setting.Value, parsed
+		}
+	}
+
+	if len(smaller) == 0 {
+		return
+	}
+
+	c.logger.Subprocess(fmt.Sprintf("Warning: Nginx's client_max_body_size (%s) is smaller than PHP's %s", limit, strings.Join(smaller, " and ")))
+	c.logger.Action("Larger requests, such as file uploads, are rejected with a 413 before they reach PHP")
+	c.logger.Action(fmt.Sprintf("Set $BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE, or a path in $BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE_LOCATIONS, to at least %s", required))
+}
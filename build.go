@@ -1,8 +1,15 @@
 package phpnginx
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
 	"github.com/paketo-buildpacks/packit/v2"
 	"github.com/paketo-buildpacks/packit/v2/draft"
+	"github.com/paketo-buildpacks/packit/v2/fs"
 	"github.com/paketo-buildpacks/packit/v2/scribe"
 )
 
@@ -14,14 +21,32 @@ type ConfigWriter interface {
 	Write(workingDir string) (string, error)
 }
 
+//go:generate faux --interface ConfigLinter --output fakes/config_linter.go
+
+// ConfigLinter checks a rendered Nginx configuration file, and the files it
+// includes, for errors that would keep Nginx from starting.
+type ConfigLinter interface {
+	Lint(path string) error
+}
+
+//go:generate faux --interface ConfigValidator --output fakes/config_validator.go
+
+// ConfigValidator checks a rendered Nginx configuration file using Nginx
+// itself.
+type ConfigValidator interface {
+	Validate(workingDir, path string) error
+}
+
 // Build will return a packit.BuildFunc that will be invoked during the build
 // phase of the buildpack lifecycle.
 //
 // Build will create a layer dedicated to Nginx configuration, configure default Nginx
-// settings, incorporate other configuration sources, and make the
+// settings, incorporate other configuration sources, check the result for
+// errors, and make the
 // configuration available at both build-time and
-// launch-time.
-func Build(nginxConfigWriter ConfigWriter, nginxFpmConfigWriter ConfigWriter, logger scribe.Emitter) packit.BuildFunc {
+// launch-time. Unless $BP_PHP_NGINX_SKIP_PROCESS is set, it also installs
+// the launcher and sets up a default "web" process that runs Nginx and FPM.
+func Build(nginxConfigWriter ConfigWriter, nginxFpmConfigWriter ConfigWriter, configLinter ConfigLinter, configValidator ConfigValidator, logger scribe.Emitter) packit.BuildFunc {
 	return func(context packit.BuildContext) (packit.BuildResult, error) {
 		logger.Title("%s %s", context.BuildpackInfo.Name, context.BuildpackInfo.Version)
 
@@ -43,23 +68,183 @@ func Build(nginxConfigWriter ConfigWriter, nginxFpmConfigWriter ConfigWriter, lo
 		if err != nil {
 			return packit.BuildResult{}, err
 		}
-		logger.Break()
 
-		logger.Process("Setting up the Nginx-specific FPM configuration file")
-		_, err = nginxFpmConfigWriter.Write(context.WorkingDir)
+		logger.Debug.Subprocess("Checking the Nginx configuration syntax")
+		err = configLinter.Lint(nginxConfigPath)
+		if err != nil {
+			return packit.BuildResult{}, fmt.Errorf("the generated Nginx configuration is invalid:\n%w", err)
+		}
+
+		validate, err := parseValidate()
 		if err != nil {
 			return packit.BuildResult{}, err
 		}
+		if validate {
+			logger.Subprocess("Validating the Nginx configuration with 'nginx -t'")
+			err = configValidator.Validate(context.WorkingDir, nginxConfigPath)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+		}
+		logger.Break()
+
+		skipFpmConfig := false
+		if skipFpmConfigStr, ok := os.LookupEnv("BP_PHP_NGINX_SKIP_FPM_CONFIG"); ok {
+			skipFpmConfig, err = strconv.ParseBool(skipFpmConfigStr)
+			if err != nil {
+				return packit.BuildResult{}, fmt.Errorf("failed to parse $BP_PHP_NGINX_SKIP_FPM_CONFIG into boolean: %w", err)
+			}
+		}
+
+		if skipFpmConfig {
+			logger.Process("Skipping the Nginx-specific FPM configuration file")
+		} else {
+			logger.Process("Setting up the Nginx-specific FPM configuration file")
+			_, err = nginxFpmConfigWriter.Write(context.WorkingDir)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+		}
 		logger.Break()
 
 		planner := draft.NewPlanner()
 		phpNginxLayer.Launch, phpNginxLayer.Build = planner.MergeLayerTypes(PhpNginxConfig, context.Plan.Entries)
 
 		phpNginxLayer.SharedEnv.Default("PHP_NGINX_PATH", nginxConfigPath)
+
+		skipProcess := false
+		if skipProcessStr, ok := os.LookupEnv("BP_PHP_NGINX_SKIP_PROCESS"); ok {
+			skipProcess, err = strconv.ParseBool(skipProcessStr)
+			if err != nil {
+				return packit.BuildResult{}, fmt.Errorf("failed to parse $BP_PHP_NGINX_SKIP_PROCESS into boolean: %w", err)
+			}
+		}
+
+		// The default processes read the configuration from $PHP_NGINX_PATH,
+		// so the layer is needed at launch whether or not a later buildpack
+		// requires it.
+		if !skipProcess {
+			phpNginxLayer.Launch = true
+		}
+
+		if phpNginxLayer.Launch {
+			// Renders the configuration again at launch with the
+			// $BPL_PHP_NGINX_* overrides.
+			phpNginxLayer.ExecD = []string{filepath.Join(context.CNBPath, "bin", RenderExecutable)}
+		}
 		logger.EnvironmentVariables(phpNginxLayer)
 
+		layers := []packit.Layer{phpNginxLayer}
+		var launch packit.LaunchMetadata
+		if !skipProcess {
+			_, remoteFpm, err := loadFpmRemoteAddress()
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+
+			if !remoteFpm {
+				launcherLayer, err := installLauncher(context, logger)
+				if err != nil {
+					return packit.BuildResult{}, err
+				}
+				layers = append(layers, launcherLayer)
+			} else {
+				status, err := LoadFpmStatus()
+				if err != nil {
+					return packit.BuildResult{}, err
+				}
+
+				metrics, err := LoadMetrics(status)
+				if err != nil {
+					return packit.BuildResult{}, err
+				}
+				if metrics.Enabled() {
+					logger.Subprocess("Warning: the metrics exporter is not started when FPM runs in a separate container")
+				}
+			}
+
+			launch.Processes = LaunchProcesses(context.WorkingDir, remoteFpm)
+			logger.LaunchProcesses(launch.Processes)
+		}
+
 		return packit.BuildResult{
-			Layers: []packit.Layer{phpNginxLayer},
+			Layers: layers,
+			Launch: launch,
 		}, nil
 	}
 }
+
+// installLauncher copies the launcher that supervises FPM and Nginx, and the
+// metrics exporter when it is enabled, from the buildpack into a launch
+// layer, whose bin directory is on the $PATH at launch.
+func installLauncher(context packit.BuildContext, logger scribe.Emitter) (packit.Layer, error) {
+	logger.Process("Installing the FPM and Nginx launcher")
+
+	launcherLayer, err := context.Layers.Get(LauncherLayer)
+	if err != nil {
+		return packit.Layer{}, err
+	}
+
+	launcherLayer, err = launcherLayer.Reset()
+	if err != nil {
+		return packit.Layer{}, err
+	}
+	launcherLayer.Launch = true
+
+	// The launcher waits for FPM to accept connections on the addresses of
+	// the www pool and of every additional pool before it starts Nginx.
+	fpmListen, err := LoadFpmAddress()
+	if err != nil {
+		return packit.Layer{}, err
+	}
+
+	pools, err := LoadFpmPools()
+	if err != nil {
+		return packit.Layer{}, err
+	}
+
+	addresses := []string{fpmListen.Upstream()}
+	for _, pool := range pools {
+		addresses = append(addresses, pool.Listen.Upstream())
+	}
+	launcherLayer.LaunchEnv.Default("PHP_NGINX_FPM_ADDRESS", strings.Join(addresses, ","))
+
+	executables := []string{LauncherExecutable}
+
+	// The launcher also starts the metrics exporter, after Nginx, when the
+	// metrics are enabled.
+	status, err := LoadFpmStatus()
+	if err != nil {
+		return packit.Layer{}, err
+	}
+
+	metrics, err := LoadMetrics(status)
+	if err != nil {
+		return packit.Layer{}, err
+	}
+	if metrics.Enabled() {
+		executables = append(executables, ExporterExecutable)
+		launcherLayer.LaunchEnv.Default("PHP_NGINX_METRICS_ADDRESS", metrics.Address())
+		launcherLayer.LaunchEnv.Default("PHP_NGINX_STATUS_SOCKET", metrics.StatusSocket)
+		launcherLayer.LaunchEnv.Default("PHP_NGINX_FPM_STATUS_PATH", metrics.FpmStatusPath)
+	}
+
+	for _, executable := range executables {
+		source := filepath.Join(context.CNBPath, "bin", executable)
+		destination := filepath.Join(launcherLayer.Path, "bin", executable)
+		logger.Debug.Subprocess(fmt.Sprintf("Copying %s to %s", source, destination))
+
+		err = os.MkdirAll(filepath.Dir(destination), os.ModePerm)
+		if err != nil {
+			return packit.Layer{}, fmt.Errorf("failed to install the launcher: %w", err)
+		}
+
+		err = fs.Copy(source, destination)
+		if err != nil {
+			return packit.Layer{}, fmt.Errorf("failed to install the launcher: %w", err)
+		}
+	}
+	logger.EnvironmentVariables(launcherLayer)
+
+	return launcherLayer, nil
+}
@@ -28,6 +28,8 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 		buffer               *bytes.Buffer
 		nginxConfigWriter    *fakes.ConfigWriter
 		nginxFpmConfigWriter *fakes.ConfigWriter
+		configLinter         *fakes.ConfigLinter
+		configValidator      *fakes.ConfigValidator
 
 		buildContext          packit.BuildContext
 		expectedPhpNginxLayer packit.Layer
@@ -46,11 +48,17 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 		cnbDir, err = os.MkdirTemp("", "cnb")
 		Expect(err).NotTo(HaveOccurred())
 
+		Expect(os.MkdirAll(filepath.Join(cnbDir, "bin"), os.ModePerm)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(cnbDir, "bin", "php-nginx-launcher"), []byte("launcher"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(cnbDir, "bin", "php-nginx-exporter"), []byte("exporter"), 0755)).To(Succeed())
+
 		buffer = bytes.NewBuffer(nil)
 		logEmitter := scribe.NewEmitter(buffer)
 
 		nginxConfigWriter = &fakes.ConfigWriter{}
 		nginxFpmConfigWriter = &fakes.ConfigWriter{}
+		configLinter = &fakes.ConfigLinter{}
+		configValidator = &fakes.ConfigValidator{}
 
 		nginxConfigWriter.WriteCall.Returns.String = "some-workspace/nginx.conf"
 		nginxFpmConfigWriter.WriteCall.Returns.String = "some-workspace/nginx-fpm.conf"
@@ -82,9 +90,11 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			BuildEnv:         packit.Environment{},
 			LaunchEnv:        packit.Environment{},
 			ProcessLaunchEnv: map[string]packit.Environment{},
+			Launch:           true,
+			ExecD:            []string{filepath.Join(cnbDir, "bin", "php-nginx-render")},
 		}
 
-		build = phpnginx.Build(nginxConfigWriter, nginxFpmConfigWriter, logEmitter)
+		build = phpnginx.Build(nginxConfigWriter, nginxFpmConfigWriter, configLinter, configValidator, logEmitter)
 	})
 
 	it.After(func() {
@@ -99,30 +109,311 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 
 		Expect(nginxConfigWriter.WriteCall.Receives.WorkingDir).To(Equal(workingDir))
 		Expect(nginxFpmConfigWriter.WriteCall.Receives.WorkingDir).To(Equal(workingDir))
+		Expect(configLinter.LintCall.Receives.Path).To(Equal("some-workspace/nginx.conf"))
+		Expect(configValidator.ValidateCall.CallCount).To(Equal(0))
 
-		Expect(result.Layers).To(HaveLen(1))
+		Expect(result.Layers).To(HaveLen(2))
 		Expect(result.Layers[0]).To(Equal(expectedPhpNginxLayer))
 	})
 
-	context("when nginx-config is required at launch time", func() {
+	it("installs the launcher into a launch layer", func() {
+		result, err := build(buildContext)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.Layers).To(HaveLen(2))
+
+		launcherLayer := result.Layers[1]
+		Expect(launcherLayer.Name).To(Equal("php-nginx-launcher"))
+		Expect(launcherLayer.Path).To(Equal(filepath.Join(layerDir, "php-nginx-launcher")))
+		Expect(launcherLayer.Launch).To(BeTrue())
+		Expect(launcherLayer.Build).To(BeFalse())
+		Expect(launcherLayer.LaunchEnv).To(Equal(packit.Environment{
+			"PHP_NGINX_FPM_ADDRESS.default": "unix:/tmp/php-fpm.socket",
+		}))
+
+		contents, err := os.ReadFile(filepath.Join(layerDir, "php-nginx-launcher", "bin", "php-nginx-launcher"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).To(Equal("launcher"))
+		Expect(filepath.Join(layerDir, "php-nginx-launcher", "bin", "php-nginx-exporter")).NotTo(BeAnExistingFile())
+
+		info, err := os.Stat(filepath.Join(layerDir, "php-nginx-launcher", "bin", "php-nginx-launcher"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0755)))
+	})
+
+	context("when BP_PHP_FPM_POOLS is set", func() {
+		it.Before(func() {
+			Expect(os.Setenv("BP_PHP_FPM_POOLS", "admin")).To(Succeed())
+			Expect(os.Setenv("BP_PHP_FPM_POOL_ADMIN_PATH", "/admin/")).To(Succeed())
+		})
+
+		it.After(func() {
+			Expect(os.Unsetenv("BP_PHP_FPM_POOLS")).To(Succeed())
+			Expect(os.Unsetenv("BP_PHP_FPM_POOL_ADMIN_PATH")).To(Succeed())
+		})
+
+		it("makes the launcher wait for every pool", func() {
+			result, err := build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+
+			launcherLayer := result.Layers[1]
+			Expect(launcherLayer.LaunchEnv).To(Equal(packit.Environment{
+				"PHP_NGINX_FPM_ADDRESS.default": "unix:/tmp/php-fpm.socket,unix:/tmp/php-fpm-admin.socket",
+			}))
+		})
+	})
+
+	context("when BP_PHP_NGINX_ENABLE_METRICS is set", func() {
+		it.Before(func() {
+			Expect(os.Setenv("BP_PHP_NGINX_ENABLE_METRICS", "true")).To(Succeed())
+			Expect(os.Setenv("BP_PHP_NGINX_METRICS_PORT", "9200")).To(Succeed())
+		})
+
+		it.After(func() {
+			Expect(os.Unsetenv("BP_PHP_NGINX_ENABLE_METRICS")).To(Succeed())
+			Expect(os.Unsetenv("BP_PHP_NGINX_METRICS_PORT")).To(Succeed())
+		})
+
+		it("installs the metrics exporter next to the launcher", func() {
+			result, err := build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+
+			launcherLayer := result.Layers[1]
+			Expect(launcherLayer.LaunchEnv).To(Equal(packit.Environment{
+				"PHP_NGINX_FPM_ADDRESS.default":     "unix:/tmp/php-fpm.socket",
+				"PHP_NGINX_METRICS_ADDRESS.default": ":9200",
+				"PHP_NGINX_STATUS_SOCKET.default":   "/tmp/php-nginx-status.socket",
+				"PHP_NGINX_FPM_STATUS_PATH.default": "/fpm-status",
+			}))
+
+			contents, err := os.ReadFile(filepath.Join(layerDir, "php-nginx-launcher", "bin", "php-nginx-exporter"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("exporter"))
+		})
+
+		context("when FPM runs in a separate container", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_FPM_REMOTE_ADDRESS", "php-fpm:9000")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_FPM_REMOTE_ADDRESS")).To(Succeed())
+			})
+
+			it("warns that the exporter is not started", func() {
+				_, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(buffer.String()).To(ContainSubstring("Warning: the metrics exporter is not started when FPM runs in a separate container"))
+			})
+		})
+	})
+
+	it("returns a default web process that runs FPM and Nginx under the launcher", func() {
+		result, err := build(buildContext)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.Launch.Processes).To(Equal([]packit.Process{
+			{
+				Type:    "web",
+				Command: "php-nginx-launcher",
+				Args:    []string{"-p", workingDir},
+				Direct:  true,
+				Default: true,
+			},
+			{
+				Type:    "nginx",
+				Command: fmt.Sprintf(`nginx -p %q -c "$PHP_NGINX_PATH"`, workingDir),
+			},
+			{
+				Type:    "php-fpm",
+				Command: `php-fpm -y "$PHP_FPM_PATH" -F`,
+			},
+		}))
+
+		Expect(buffer.String()).To(ContainSubstring("Assigning launch processes:"))
+
+		Expect(result.Layers[0].Launch).To(BeTrue())
+		Expect(result.Layers[0].ExecD).To(Equal([]string{filepath.Join(cnbDir, "bin", "php-nginx-render")}))
+	})
+
+	context("when FPM runs in a separate container", func() {
+		it.Before(func() {
+			Expect(os.Setenv("BP_PHP_FPM_REMOTE_ADDRESS", "php-fpm:9000")).To(Succeed())
+		})
+
+		it.After(func() {
+			Expect(os.Unsetenv("BP_PHP_FPM_REMOTE_ADDRESS")).To(Succeed())
+		})
+
+		it("returns a default web process that only runs Nginx", func() {
+			result, err := build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(result.Layers).To(HaveLen(1))
+
+			Expect(result.Launch.Processes[0]).To(Equal(packit.Process{
+				Type:    "web",
+				Command: fmt.Sprintf(`nginx -p %q -c "$PHP_NGINX_PATH"`, workingDir),
+				Default: true,
+			}))
+		})
+	})
+
+	context("when BP_PHP_NGINX_SKIP_PROCESS is true", func() {
 		it.Before(func() {
-			buildContext.Plan.Entries[0].Metadata = map[string]interface{}{
-				"launch": true,
-			}
+			Expect(os.Setenv("BP_PHP_NGINX_SKIP_PROCESS", "true")).To(Succeed())
+		})
 
-			expectedPhpNginxLayer.Launch = true
+		it.After(func() {
+			Expect(os.Unsetenv("BP_PHP_NGINX_SKIP_PROCESS")).To(Succeed())
 		})
 
-		it("makes the layer available at launch time", func() {
+		it("does not return any launch processes", func() {
 			result, err := build(buildContext)
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(result.Layers).To(HaveLen(1))
-			Expect(result.Layers[0]).To(Equal(expectedPhpNginxLayer))
+			Expect(result.Launch).To(Equal(packit.LaunchMetadata{}))
+		})
+
+		it("does not make the layer available at launch time", func() {
+			result, err := build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(result.Layers[0].Launch).To(BeFalse())
+			Expect(result.Layers[0].ExecD).To(BeEmpty())
+		})
+
+		context("when nginx-config is required at launch time", func() {
+			it.Before(func() {
+				buildContext.Plan.Entries[0].Metadata = map[string]interface{}{
+					"launch": true,
+				}
+			})
+
+			it("makes the layer available at launch time", func() {
+				result, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(result.Layers).To(HaveLen(1))
+				Expect(result.Layers[0]).To(Equal(expectedPhpNginxLayer))
+			})
+		})
+	})
+
+	context("when BP_PHP_NGINX_SKIP_FPM_CONFIG is true", func() {
+		it.Before(func() {
+			Expect(os.Setenv("BP_PHP_NGINX_SKIP_FPM_CONFIG", "true")).To(Succeed())
+		})
+
+		it.After(func() {
+			Expect(os.Unsetenv("BP_PHP_NGINX_SKIP_FPM_CONFIG")).To(Succeed())
+		})
+
+		it("does not write the nginx-fpm config file", func() {
+			_, err := build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(nginxConfigWriter.WriteCall.CallCount).To(Equal(1))
+			Expect(nginxFpmConfigWriter.WriteCall.CallCount).To(Equal(0))
+			Expect(buffer.String()).To(ContainSubstring("Skipping the Nginx-specific FPM configuration file"))
+		})
+	})
+
+	context("when BP_PHP_NGINX_VALIDATE is true", func() {
+		it.Before(func() {
+			Expect(os.Setenv("BP_PHP_NGINX_VALIDATE", "true")).To(Succeed())
+		})
+
+		it.After(func() {
+			Expect(os.Unsetenv("BP_PHP_NGINX_VALIDATE")).To(Succeed())
+		})
+
+		it("validates the nginx config file with nginx", func() {
+			_, err := build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(configValidator.ValidateCall.Receives.WorkingDir).To(Equal(workingDir))
+			Expect(configValidator.ValidateCall.Receives.Path).To(Equal("some-workspace/nginx.conf"))
+			Expect(buffer.String()).To(ContainSubstring("Validating the Nginx configuration with 'nginx -t'"))
+		})
+
+		context("when nginx rejects the config file", func() {
+			it.Before(func() {
+				configValidator.ValidateCall.Returns.Error = errors.New("nginx rejected the configuration")
+			})
+
+			it("returns an error", func() {
+				_, err := build(buildContext)
+				Expect(err).To(MatchError("nginx rejected the configuration"))
+			})
 		})
 	})
 
 	context("failure cases", func() {
+		context("when BP_PHP_NGINX_SKIP_FPM_CONFIG cannot be parsed into a bool", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_NGINX_SKIP_FPM_CONFIG", "blah")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_NGINX_SKIP_FPM_CONFIG")).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := build(buildContext)
+				Expect(err).To(MatchError(ContainSubstring("failed to parse $BP_PHP_NGINX_SKIP_FPM_CONFIG into boolean:")))
+			})
+		})
+
+		context("when BP_PHP_NGINX_SKIP_PROCESS cannot be parsed into a bool", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_NGINX_SKIP_PROCESS", "blah")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_NGINX_SKIP_PROCESS")).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := build(buildContext)
+				Expect(err).To(MatchError(ContainSubstring("failed to parse $BP_PHP_NGINX_SKIP_PROCESS into boolean:")))
+			})
+		})
+
+		context("when BP_PHP_NGINX_ENABLE_METRICS cannot be parsed into a bool while FPM runs in a separate container", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_NGINX_ENABLE_METRICS", "blah")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_FPM_REMOTE_ADDRESS", "php-fpm:9000")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_NGINX_ENABLE_METRICS")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_FPM_REMOTE_ADDRESS")).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := build(buildContext)
+				Expect(err).To(MatchError(ContainSubstring("failed to parse $BP_PHP_NGINX_ENABLE_METRICS into boolean:")))
+			})
+		})
+
+		context("when BP_PHP_NGINX_VALIDATE cannot be parsed into a bool", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_NGINX_VALIDATE", "blah")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_NGINX_VALIDATE")).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := build(buildContext)
+				Expect(err).To(MatchError(ContainSubstring("failed to parse $BP_PHP_NGINX_VALIDATE into boolean:")))
+			})
+		})
+
 		context("when config layer cannot be gotten", func() {
 			it.Before(func() {
 				err := os.WriteFile(filepath.Join(layerDir, fmt.Sprintf("%s.toml", phpnginx.PhpNginxConfigLayer)), nil, 0000)
@@ -135,6 +426,17 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			})
 		})
 
+		context("when the launcher cannot be installed", func() {
+			it.Before(func() {
+				Expect(os.Remove(filepath.Join(cnbDir, "bin", "php-nginx-launcher"))).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := build(buildContext)
+				Expect(err).To(MatchError(ContainSubstring("failed to install the launcher:")))
+			})
+		})
+
 		context("when nginx config file cannot be written", func() {
 			it.Before(func() {
 				nginxConfigWriter.WriteCall.Returns.Error = errors.New("nginx config writing error")
@@ -146,6 +448,17 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			})
 		})
 
+		context("when the nginx config file is invalid", func() {
+			it.Before(func() {
+				configLinter.LintCall.Returns.Error = errors.New("some-workspace/nginx.conf:1: unexpected \"}\"")
+			})
+
+			it("returns an error", func() {
+				_, err := build(buildContext)
+				Expect(err).To(MatchError("the generated Nginx configuration is invalid:\nsome-workspace/nginx.conf:1: unexpected \"}\""))
+			})
+		})
+
 		context("when nginx-fpm config file cannot be written", func() {
 			it.Before(func() {
 				nginxFpmConfigWriter.WriteCall.Returns.Error = errors.New("nginx-fpm config writing error")
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/paketo-buildpacks/php-nginx/exporter"
+)
+
+// shutdownTimeout bounds how long in-flight scrapes are given to finish once
+// the exporter is asked to stop.
+const shutdownTimeout = 5 * time.Second
+
+// main serves the metrics of Nginx and FPM at /metrics until it receives
+// SIGQUIT, which the launcher sends to stop its processes, SIGTERM or SIGINT.
+func main() {
+	address := flag.String("listen", ":9113", "the address to serve /metrics on")
+	socket := flag.String("socket", "/tmp/php-nginx-status.socket", "the unix socket Nginx serves its status and FPM's on")
+	fpmStatusPath := flag.String("fpm-status-path", "/fpm-status", "the pm.status_path of the FPM www pool")
+	flag.Parse()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exporter.NewExporter(*socket, *fpmStatusPath, os.Stderr))
+
+	server := &http.Server{
+		Addr:              *address,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		<-signals
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "php-nginx-exporter: serving metrics on %s/metrics\n", *address)
+	err := server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "php-nginx-exporter: %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/paketo-buildpacks/php-nginx/launcher"
+)
+
+func main() {
+	workingDir, err := os.Getwd()
+	if err != nil {
+		fail(err)
+	}
+
+	prefixDir := flag.String("p", workingDir, "the Nginx prefix directory")
+	flag.Parse()
+
+	options, err := launcher.LoadOptions()
+	if err != nil {
+		fail(err)
+	}
+
+	fpm, err := launcher.FpmProcess()
+	if err != nil {
+		fail(err)
+	}
+
+	nginx, err := launcher.NginxProcess(*prefixDir)
+	if err != nil {
+		fail(err)
+	}
+
+	processes := []launcher.Process{fpm, nginx}
+	if exporter, ok := launcher.ExporterProcess(); ok {
+		processes = append(processes, exporter)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
+
+	err = launcher.NewSupervisor(os.Stdout, os.Stderr, options).Run(signals, processes...)
+	if err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "php-nginx-launcher: %s\n", err)
+	os.Exit(1)
+}
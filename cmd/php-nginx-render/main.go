@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/BurntSushi/toml"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	phpnginx "github.com/paketo-buildpacks/php-nginx"
+)
+
+// main is run from exec.d before each process starts. It renders the Nginx
+// configuration in place, with the workers sized for the container's CPU
+// quota and open file limit, and the FPM configuration, with the www pool
+// sized for its memory limit, applying the launch-time overrides to both.
+// When the application directory is read-only, it renders the Nginx
+// configuration into a temporary directory instead and points
+// $PHP_NGINX_PATH at the result by writing it to file descriptor 3.
+func main() {
+	buildPath := os.Getenv("PHP_NGINX_PATH")
+	if buildPath == "" {
+		return
+	}
+
+	logger := scribe.NewEmitter(os.Stdout).WithLevel(os.Getenv("BP_LOG_LEVEL"))
+	renderer := phpnginx.NewNginxConfigRenderer(logger)
+
+	limits, err := phpnginx.LoadContainerLimits("/sys/fs/cgroup")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "php-nginx-render: not sizing Nginx and FPM for the container: %s\n", err)
+	} else {
+		renderer = renderer.WithContainerLimits(limits)
+	}
+
+	outputPath := buildPath
+	err = renderer.Render(buildPath, outputPath)
+	if errors.Is(err, fs.ErrPermission) || errors.Is(err, syscall.EROFS) {
+		outputPath = filepath.Join(os.TempDir(), "php-nginx", filepath.Base(buildPath))
+		err = renderer.Render(buildPath, outputPath)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		fail(err)
+	}
+
+	err = phpnginx.NewNginxConfigLinter(logger).Lint(outputPath)
+	if err != nil {
+		fail(fmt.Errorf("the rendered Nginx configuration is invalid:\n%w", err))
+	}
+
+	// FPM includes its configuration from a fixed path, so it can only be
+	// sized for the container when the application directory is writable.
+	fpmPath := filepath.Join(filepath.Dir(buildPath), ".php.fpm.bp", "nginx-fpm.conf")
+	err = renderer.RenderFpm(fpmPath, fpmPath)
+	if errors.Is(err, fs.ErrPermission) || errors.Is(err, syscall.EROFS) {
+		fmt.Fprintf(os.Stderr, "php-nginx-render: not sizing FPM for the container: %s\n", err)
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		fail(err)
+	}
+
+	if outputPath != buildPath {
+		err = toml.NewEncoder(os.NewFile(3, "/dev/fd/3")).Encode(map[string]string{
+			"PHP_NGINX_PATH": outputPath,
+		})
+		if err != nil {
+			fail(err)
+		}
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "php-nginx-render: %s\n", err)
+	os.Exit(1)
+}
@@ -3,11 +3,15 @@ package phpnginx
 import (
 	"bytes"
 	_ "embed"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"text/template"
+	"time"
+	"unicode"
 
 	"github.com/paketo-buildpacks/packit/v2/scribe"
 )
@@ -25,15 +29,66 @@ type NginxConfig struct {
 	DisableHTTPSRedirect bool
 	AppRoot              string
 	WebDirectory         string
-	FpmSocket            string
+	WorkerProcesses      string
+	WorkerConnections    int
+	WorkerRlimitNofile   int
+	RequestTimeout       time.Duration
+	ClientHeaderTimeout  time.Duration
+	ClientBodyTimeout    time.Duration
+	KeepaliveTimeout     time.Duration
+	ClientMaxBodySize    string
+	FpmListen            FpmAddress
+	FpmDocumentRoot      string
+	FpmPools             []FpmPool
+	BodySizeLocations    []NginxBodySizeLocation
+	FpmStatus            FpmStatus
+	Metrics              Metrics
+	ErrorLog             NginxErrorLog
+	AccessLog            NginxAccessLog
+	TraceContext         bool
+	FrontController      string
+	FrontControllerSet   bool
+	IndexFiles           []string
+	Presets              []string
+	Locations            []NginxLocation
+	Maps                 []NginxMap
+	Headers              []NginxHeader
+	FastCGIParams        []FastCGIParam
 }
 
 type NginxFpmConfig struct {
-	FpmSocket string
+	FpmListen      FpmAddress
+	RequestTimeout time.Duration
+	Pools          []FpmPool
+	ProcessManager FpmProcessManager
+	Status         FpmStatus
+}
+
+// fastcgiPass is the data used to render the FastCGI parameters of a location
+// that passes requests to an FPM upstream.
+type fastcgiPass struct {
+	Config     NginxConfig
+	Upstream   string
+	Timeout    string
+	ScriptName string
+}
+
+func newFastCGIPass(config NginxConfig, upstream, timeout, scriptName string) fastcgiPass {
+	if scriptName == "" {
+		scriptName = "$fastcgi_script_name"
+	}
+
+	return fastcgiPass{
+		Config:     config,
+		Upstream:   upstream,
+		Timeout:    timeout,
+		ScriptName: scriptName,
+	}
 }
 
 type NginxConfigWriter struct {
-	logger scribe.Emitter
+	logger  scribe.Emitter
+	presets PresetRegistry
 }
 
 type NginxFpmConfigWriter struct {
@@ -42,10 +97,18 @@ type NginxFpmConfigWriter struct {
 
 func NewNginxConfigWriter(logger scribe.Emitter) NginxConfigWriter {
 	return NginxConfigWriter{
-		logger: logger,
+		logger:  logger,
+		presets: DefaultPresets(),
 	}
 }
 
+// WithPresets returns a copy of the writer that selects presets from the
+// given registry instead of the built-in presets.
+func (c NginxConfigWriter) WithPresets(presets PresetRegistry) NginxConfigWriter {
+	c.presets = presets
+	return c
+}
+
 func NewFpmNginxConfigWriter(logger scribe.Emitter) NginxFpmConfigWriter {
 	return NginxFpmConfigWriter{
 		logger: logger,
@@ -53,15 +116,14 @@ func NewFpmNginxConfigWriter(logger scribe.Emitter) NginxFpmConfigWriter {
 }
 
 func (c NginxConfigWriter) Write(workingDir string) (string, error) {
-	tmpl, err := template.New("nginx.conf").Parse(NGINXConfTemplate)
-	if err != nil {
-		return "", fmt.Errorf("failed to parse Nginx config template: %w", err)
-	}
-
 	data := NginxConfig{
-		AppRoot: workingDir,
+		AppRoot:           workingDir,
+		WorkerProcesses:   "auto",
+		WorkerConnections: 1024,
+		KeepaliveTimeout:  defaultKeepaliveTimeout,
 	}
 
+	var err error
 	var configFiles []string
 	// Configuration set by this buildpack
 	// If there's a user-provided Nginx conf, include it in the base configuration.
@@ -89,7 +151,21 @@ func (c NginxConfigWriter) Write(workingDir string) (string, error) {
 		c.logger.Debug.Subprocess(fmt.Sprintf("Including user-provided Nginx HTTP configuration from: %s", userHttpConf))
 	}
 
+	// The framework only chooses defaults, so a composer.json that cannot be
+	// read does not fail the build.
+	framework, err := DetectFramework(workingDir)
+	if err != nil {
+		c.logger.Subprocess(fmt.Sprintf("Warning: no framework detected: %s", err))
+		framework = Framework{}
+	}
+	if framework.Name != "" {
+		c.logger.Subprocess(fmt.Sprintf("Detected %s application", framework.Name))
+	}
+
 	webDir := os.Getenv("BP_PHP_WEB_DIR")
+	if webDir == "" {
+		webDir = framework.WebDirectory
+	}
 	if webDir == "" {
 		webDir = "htdocs"
 	}
@@ -118,24 +194,203 @@ func (c NginxConfigWriter) Write(workingDir string) (string, error) {
 	data.DisableHTTPSRedirect = !enableHTTPSRedirect
 	c.logger.Debug.Subprocess(fmt.Sprintf("Enable HTTPS redirect: %t", enableHTTPSRedirect))
 
-	fpmSocket := "/tmp/php-fpm.socket"
-	data.FpmSocket = fpmSocket
-	c.logger.Debug.Subprocess(fmt.Sprintf("FPM socket: %s", fpmSocket))
+	data.FrontController = framework.FrontController
+	if frontController, ok := os.LookupEnv("BP_PHP_NGINX_FRONT_CONTROLLER"); ok {
+		data.FrontController = strings.TrimPrefix(frontController, "/")
+		data.FrontControllerSet = true
+	}
 
-	var b bytes.Buffer
-	err = tmpl.Execute(&b, data)
+	data.IndexFiles = []string{"index.php", "index.html"}
+	if indexFiles, ok := os.LookupEnv("BP_PHP_NGINX_INDEX"); ok {
+		data.IndexFiles = splitList(indexFiles)
+		if len(data.IndexFiles) == 0 {
+			return "", fmt.Errorf("failed to parse $BP_PHP_NGINX_INDEX: at least one index file must be given")
+		}
+	}
+	c.logger.Debug.Subprocess(fmt.Sprintf("Index files: %s", strings.Join(data.IndexFiles, " ")))
+
+	data.ErrorLog, err = LoadErrorLog()
+	if err != nil {
+		return "", err
+	}
+	c.logger.Debug.Subprocess(fmt.Sprintf("Error log level: %s", data.ErrorLog.Level))
+	if data.ErrorLog.ServerDestination != "" {
+		c.logger.Debug.Subprocess(fmt.Sprintf("Server error log: %s", data.ErrorLog.ServerDestination))
+	}
+
+	data.AccessLog, err = LoadAccessLog()
+	if err != nil {
+		return "", err
+	}
+	if data.AccessLog.Off {
+		c.logger.Subprocess("Access log is off")
+	} else {
+		c.logger.Debug.Subprocess(fmt.Sprintf("Access log format: %s", data.AccessLog.Format))
+		if data.AccessLog.SampleRate != "" {
+			c.logger.Debug.Subprocess(fmt.Sprintf("Access log sample rate: %s", data.AccessLog.SampleRate))
+		}
+	}
+	data.Maps = append(data.Maps, data.AccessLog.Maps()...)
+
+	requestIDHeader, err := LoadRequestIDHeader()
+	if err != nil {
+		return "", err
+	}
+	c.logger.Debug.Subprocess(fmt.Sprintf("Request ID header: %s", requestIDHeader))
+	addRequestID(&data, requestIDHeader)
+
+	data.TraceContext, err = LoadTraceContext()
+	if err != nil {
+		return "", err
+	}
+	if data.TraceContext {
+		c.logger.Subprocess("Propagating W3C trace context to FPM")
+		addTraceContext(&data)
+	}
+
+	fpmListen, remote, err := LoadFpmUpstream()
+	if err != nil {
+		return "", err
+	}
+	data.FpmListen = fpmListen
+	if remote {
+		c.logger.Debug.Subprocess(fmt.Sprintf("Remote %s", fpmListen.Description()))
+	} else {
+		c.logger.Debug.Subprocess(fpmListen.Description())
+	}
+
+	// In split-container deployments the application lives at a different
+	// path inside the FPM container.
+	data.FpmDocumentRoot = "$document_root"
+	if remoteRoot, ok := os.LookupEnv("BP_PHP_FPM_REMOTE_ROOT"); ok && remoteRoot != "" {
+		if !filepath.IsAbs(remoteRoot) {
+			return "", fmt.Errorf("failed to parse $BP_PHP_FPM_REMOTE_ROOT: %q must be an absolute path", remoteRoot)
+		}
+		data.FpmDocumentRoot = filepath.Clean(remoteRoot)
+		c.logger.Debug.Subprocess(fmt.Sprintf("FPM document root: %s", data.FpmDocumentRoot))
+	}
+
+	data.RequestTimeout, err = LoadRequestTimeout()
+	if err != nil {
+		return "", err
+	}
+	if data.RequestTimeout != 0 {
+		c.logger.Debug.Subprocess(fmt.Sprintf("Request timeout: %s", formatTimeout(data.RequestTimeout)))
+	}
+
+	for _, setting := range []struct {
+		name    string
+		target  *time.Duration
+		message string
+	}{
+		{"BP_PHP_NGINX_CLIENT_HEADER_TIMEOUT", &data.ClientHeaderTimeout, "Client header timeout"},
+		{"BP_PHP_NGINX_CLIENT_BODY_TIMEOUT", &data.ClientBodyTimeout, "Client body timeout"},
+		{"BP_PHP_NGINX_KEEPALIVE_TIMEOUT", &data.KeepaliveTimeout, "Keepalive timeout"},
+	} {
+		timeout, ok, err := lookupTimeout(setting.name)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			*setting.target = timeout
+			c.logger.Debug.Subprocess(fmt.Sprintf("%s: %s", setting.message, formatTimeout(timeout)))
+		}
+	}
+
+	data.FpmPools, err = LoadFpmPools()
+	if err != nil {
+		return "", err
+	}
+	for _, pool := range data.FpmPools {
+		c.logger.Debug.Subprocess(fmt.Sprintf("Routing %s to the %s FPM pool", pool.PathPrefix, pool.Name))
+	}
+
+	data.ClientMaxBodySize, err = LoadClientMaxBodySize()
+	if err != nil {
+		return "", err
+	}
+	if data.ClientMaxBodySize != "" {
+		c.logger.Debug.Subprocess(fmt.Sprintf("Maximum request body size: %s", data.ClientMaxBodySize))
+	}
+
+	data.BodySizeLocations, err = LoadBodySizeLocations(data.FpmPools, data.RequestTimeout)
+	if err != nil {
+		return "", err
+	}
+	for _, pool := range data.FpmPools {
+		if pool.MaxBodySize != "" {
+			c.logger.Debug.Subprocess(fmt.Sprintf("Maximum request body size under %s: %s", pool.PathPrefix, pool.MaxBodySize))
+		}
+	}
+	for _, location := range data.BodySizeLocations {
+		c.logger.Debug.Subprocess(fmt.Sprintf("Maximum request body size under %s: %s", location.PathPrefix, location.MaxBodySize))
+	}
+
+	data.FpmStatus, err = LoadFpmStatus()
+	if err != nil {
+		return "", err
+	}
+	if data.FpmStatus.StatusPath != "" {
+		c.logger.Subprocess(fmt.Sprintf("Serving the FPM status page at %s and ping at %s to %s", data.FpmStatus.StatusPath, data.FpmStatus.PingPath, strings.Join(data.FpmStatus.Allow, ", ")))
+		if data.FpmStatus.Port != 0 {
+			c.logger.Debug.Subprocess(fmt.Sprintf("FPM status port: %d", data.FpmStatus.Port))
+		}
+	}
+
+	data.Metrics, err = LoadMetrics(data.FpmStatus)
+	if err != nil {
+		return "", err
+	}
+	if data.Metrics.Enabled() {
+		c.logger.Subprocess(fmt.Sprintf("Serving Nginx and FPM metrics on port %d", data.Metrics.Port))
+	}
+
+	presetNames, ok := os.LookupEnv("BP_PHP_NGINX_PRESETS")
+	if ok {
+		data.Presets = splitList(presetNames)
+	} else if _, registered := c.presets[framework.Name]; registered {
+		data.Presets = []string{framework.Name}
+	}
+
+	presets, err := c.presets.Get(data.Presets...)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse $BP_PHP_NGINX_PRESETS: %w", err)
+	}
+
+	for _, preset := range presets {
+		err = preset.Apply(&data)
+		if err != nil {
+			return "", fmt.Errorf("failed to apply Nginx preset %q: %w", preset.Name(), err)
+		}
+		c.logger.Subprocess(fmt.Sprintf("Using %s preset", preset.Name()))
+	}
+
+	if data.FrontController != "" {
+		c.logger.Debug.Subprocess(fmt.Sprintf("Front controller: %s", data.FrontController))
+	}
+
+	c.checkUploadSizes(workingDir, data)
+
+	content, err := renderNginxConfig(data)
 	if err != nil {
-		// not tested
 		return "", err
 	}
 
 	path := filepath.Join(workingDir, "nginx.conf")
-	err = os.WriteFile(path, b.Bytes(), 0600)
+	err = os.WriteFile(path, content, 0600)
 	if err != nil {
 		return "", err
 	}
 
-	for _, file := range append(configFiles, path) {
+	// The configuration is saved so that it can be rendered again at launch
+	// with launch-time overrides.
+	savedPath := SavedNginxConfigPath(path)
+	err = saveConfig(data, savedPath)
+	if err != nil {
+		return "", err
+	}
+
+	for _, file := range append(configFiles, path, savedPath) {
 		info, err := os.Stat(file)
 		if err != nil {
 			return "", err
@@ -151,43 +406,144 @@ func (c NginxConfigWriter) Write(workingDir string) (string, error) {
 }
 
 func (c NginxFpmConfigWriter) Write(workingDir string) (string, error) {
-	tmpl, err := template.New("nginx-fpm.conf").Parse(NGINXFPMConfTemplate)
+	// Configuration set by this buildpack
+
+	fpmListen, err := LoadFpmAddress()
 	if err != nil {
-		return "", fmt.Errorf("failed to parse Nginx-Fpm config template: %w", err)
+		return "", err
 	}
+	c.logger.Debug.Subprocess(fpmListen.Description())
 
-	// Configuration set by this buildpack
+	requestTimeout, err := LoadRequestTimeout()
+	if err != nil {
+		return "", err
+	}
+	if requestTimeout != 0 {
+		c.logger.Debug.Subprocess(fmt.Sprintf("FPM request timeout: %s", formatTimeout(requestTimeout)))
+	}
 
-	// If there's a user-provided Nginx conf, include it in the base configuration.
-	fpmSocket := "/tmp/php-fpm.socket"
-	c.logger.Debug.Subprocess(fmt.Sprintf("FPM socket: %s", fpmSocket))
+	pools, err := LoadFpmPools()
+	if err != nil {
+		return "", err
+	}
+	for _, pool := range pools {
+		c.logger.Debug.Subprocess(fmt.Sprintf("FPM pool %s: %s", pool.Name, pool.Listen.Description()))
+	}
 
-	data := NginxFpmConfig{
-		FpmSocket: fpmSocket,
+	status, err := LoadFpmStatus()
+	if err != nil {
+		return "", err
 	}
 
-	var b bytes.Buffer
-	err = tmpl.Execute(&b, data)
+	// The metrics exporter reads the status page of the www pool, even when
+	// it is not exposed through Nginx.
+	metrics, err := LoadMetrics(status)
 	if err != nil {
-		// not tested
 		return "", err
 	}
+	if metrics.Enabled() && status.StatusPath == "" {
+		status.StatusPath = metrics.FpmStatusPath
+	}
 
-	path := filepath.Join(workingDir, ".php.fpm.bp", "nginx-fpm.conf")
-	err = os.WriteFile(path, b.Bytes(), 0600)
+	data := NginxFpmConfig{
+		FpmListen:      fpmListen,
+		RequestTimeout: requestTimeout,
+		Pools:          pools,
+		Status:         status,
+	}
+
+	content, err := renderNginxFpmConfig(data)
 	if err != nil {
 		return "", err
 	}
 
-	info, err := os.Stat(path)
+	path := filepath.Join(workingDir, ".php.fpm.bp", "nginx-fpm.conf")
+	err = os.WriteFile(path, content, 0600)
 	if err != nil {
 		return "", err
 	}
 
-	err = os.Chmod(path, info.Mode()|0040)
+	// The configuration is saved so that the process manager can be sized
+	// for the container's memory at launch.
+	savedPath := SavedNginxConfigPath(path)
+	err = saveConfig(data, savedPath)
 	if err != nil {
 		return "", err
 	}
 
+	for _, file := range []string{path, savedPath} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+
+		err = os.Chmod(file, info.Mode()|0060)
+		if err != nil {
+			return "", err
+		}
+	}
+
 	return path, nil
 }
+
+// SavedNginxConfigPath returns the path of the data saved next to the Nginx
+// or FPM configuration file at path.
+func SavedNginxConfigPath(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".json")
+}
+
+func renderNginxConfig(data NginxConfig) ([]byte, error) {
+	tmpl, err := template.New("nginx.conf").Funcs(template.FuncMap{
+		"join":    strings.Join,
+		"fastcgi": newFastCGIPass,
+		"timeout": formatTimeout,
+	}).Parse(NGINXConfTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Nginx config template: %w", err)
+	}
+
+	var b bytes.Buffer
+	err = tmpl.Execute(&b, data)
+	if err != nil {
+		// not tested
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func renderNginxFpmConfig(data NginxFpmConfig) ([]byte, error) {
+	tmpl, err := template.New("nginx-fpm.conf").Funcs(template.FuncMap{
+		"timeout": formatTimeout,
+	}).Parse(NGINXFPMConfTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Nginx-Fpm config template: %w", err)
+	}
+
+	var b bytes.Buffer
+	err = tmpl.Execute(&b, data)
+	if err != nil {
+		// not tested
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func saveConfig(data interface{}, path string) error {
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		// not tested
+		return err
+	}
+
+	return os.WriteFile(path, content, 0600)
+}
+
+// splitList splits a list of values separated by commas and/or whitespace,
+// dropping empty entries.
+func splitList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
@@ -2,9 +2,11 @@ package phpnginx_test
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/paketo-buildpacks/packit/v2/scribe"
@@ -14,6 +16,35 @@ import (
 	. "github.com/onsi/gomega"
 )
 
+type paramsPreset struct{}
+
+func (p paramsPreset) Name() string {
+	return "params"
+}
+
+func (p paramsPreset) Apply(config *phpnginx.NginxConfig) error {
+	config.Maps = append(config.Maps, phpnginx.NginxMap{
+		Source:   "$http_user_agent",
+		Variable: "$is_bot",
+		Entries: []phpnginx.NginxMapEntry{
+			{Key: "default", Value: "0"},
+			{Key: "~*bot", Value: "1"},
+		},
+	})
+	config.FastCGIParams = append(config.FastCGIParams, phpnginx.FastCGIParam{Name: "IS_BOT", Value: "$is_bot"})
+	return nil
+}
+
+type failingPreset struct{}
+
+func (p failingPreset) Name() string {
+	return "failing"
+}
+
+func (p failingPreset) Apply(config *phpnginx.NginxConfig) error {
+	return errors.New("some preset error")
+}
+
 func testConfig(t *testing.T, context spec.G, it spec.S) {
 	var (
 		Expect = NewWithT(t).Expect
@@ -57,8 +88,41 @@ func testConfig(t *testing.T, context spec.G, it spec.S) {
 			Expect(string(contents)).To(ContainSubstring(`listen       {{env "PORT"}}  default_server;`))
 			Expect(string(contents)).To(ContainSubstring("map $http_x_forwarded_proto $redirect_to_https"))
 			Expect(string(contents)).To(ContainSubstring("server unix:/tmp/php-fpm.socket;"))
+			Expect(string(contents)).To(ContainSubstring("index              index.php index.html;"))
+			Expect(string(contents)).To(ContainSubstring(`location ~* \.php$ {`))
+			Expect(string(contents)).NotTo(ContainSubstring("location / {"))
 			Expect(string(contents)).NotTo(ContainSubstring(fmt.Sprintf("include %s/.nginx.conf.d/*-server.conf", workingDir)))
 			Expect(string(contents)).NotTo(ContainSubstring(fmt.Sprintf("include %s/.nginx.conf.d/*-http.conf", workingDir)))
+			Expect(string(contents)).To(ContainSubstring("worker_processes  auto;"))
+			Expect(string(contents)).To(ContainSubstring("worker_connections  1024;"))
+			Expect(string(contents)).To(ContainSubstring("keepalive_timeout  65s;"))
+			Expect(string(contents)).NotTo(ContainSubstring("client_header_timeout"))
+			Expect(string(contents)).NotTo(ContainSubstring("client_body_timeout"))
+			Expect(string(contents)).NotTo(ContainSubstring("fastcgi_read_timeout"))
+			Expect(string(contents)).To(ContainSubstring("error_log  stderr  notice;"))
+			Expect(string(contents)).To(ContainSubstring("access_log  /dev/stdout  extended;"))
+			Expect(string(contents)).To(ContainSubstring(`$body_bytes_sent request_id=$php_request_id';`))
+			Expect(string(contents)).NotTo(ContainSubstring("vcap_request_id"))
+			Expect(string(contents)).NotTo(ContainSubstring("trace_id"))
+			Expect(string(contents)).NotTo(ContainSubstring("HTTP_TRACEPARENT"))
+			Expect(string(contents)).NotTo(ContainSubstring("log_format json"))
+		})
+
+		it("saves the configuration next to the nginx.conf file for launch-time rendering", func() {
+			path, err := nginxConfigWriter.Write(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+
+			savedPath := phpnginx.SavedNginxConfigPath(path)
+			Expect(savedPath).To(Equal(filepath.Join(workingDir, ".nginx.conf.json")))
+
+			info, err := os.Stat(savedPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().String()).To(Equal("-rw-rw----"))
+
+			contents, err := os.ReadFile(savedPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring(fmt.Sprintf(`"AppRoot": %q`, workingDir)))
+			Expect(string(contents)).To(ContainSubstring(`"WebDirectory": "htdocs"`))
 		})
 
 		context("there are user-provided conf files", func() {
@@ -124,68 +188,1482 @@ func testConfig(t *testing.T, context spec.G, it spec.S) {
 			})
 		})
 
-		context("failure cases", func() {
-			context("when the BP_PHP_NGINX_ENABLE_HTTPS value cannot be parsed into a bool", func() {
+		context("when a front controller is configured", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_NGINX_FRONT_CONTROLLER", "/app.php")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_NGINX_INDEX", "app.php, index.html")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_NGINX_FRONT_CONTROLLER")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_NGINX_INDEX")).To(Succeed())
+			})
+
+			it("writes an nginx.conf that routes unmatched requests to the front controller", func() {
+				path, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("index              app.php index.html;"))
+				Expect(string(contents)).To(ContainSubstring("try_files $uri $uri/ /app.php?$query_string;"))
+				Expect(string(contents)).To(ContainSubstring(`location ~* \.php(/|$) {`))
+				Expect(string(contents)).To(ContainSubstring(`fastcgi_split_path_info ^(.+?\.php)(/.*)$;`))
+				Expect(string(contents)).To(ContainSubstring("fastcgi_param  PATH_INFO          $path_info;"))
+				Expect(string(contents)).NotTo(ContainSubstring(`location ~* \.php$ {`))
+			})
+		})
+
+		context("when a framework is detected", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "composer.json"), []byte(`{"require": {"laravel/framework": "^11.0"}}`), 0600)).To(Succeed())
+			})
+
+			it("writes an nginx.conf using the framework's web directory and front controller", func() {
+				path, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring(fmt.Sprintf("%s/public;", workingDir)))
+				Expect(string(contents)).To(ContainSubstring("try_files $uri $uri/ /index.php?$query_string;"))
+				Expect(string(contents)).To(ContainSubstring(`add_header X-Content-Type-Options "nosniff";`))
+			})
+
+			context("when BP_PHP_WEB_DIR is set", func() {
 				it.Before(func() {
-					Expect(os.Setenv("BP_PHP_NGINX_ENABLE_HTTPS", "blah")).To(Succeed())
+					Expect(os.Setenv("BP_PHP_WEB_DIR", "some-web-dir")).To(Succeed())
 				})
 
 				it.After(func() {
-					Expect(os.Unsetenv("BP_PHP_NGINX_ENABLE_HTTPS")).To(Succeed())
+					Expect(os.Unsetenv("BP_PHP_WEB_DIR")).To(Succeed())
 				})
 
-				it("returns an error", func() {
-					_, err := nginxConfigWriter.Write(workingDir)
-					Expect(err).To(MatchError(ContainSubstring("failed to parse $BP_PHP_NGINX_ENABLE_HTTPS into boolean:")))
+				it("prefers the explicit web directory", func() {
+					path, err := nginxConfigWriter.Write(workingDir)
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := os.ReadFile(path)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(ContainSubstring(fmt.Sprintf("%s/some-web-dir;", workingDir)))
 				})
 			})
 
-			context("when the BP_PHP_ENABLE_HTTPS_REDIRECT value cannot be parsed into a bool", func() {
+			context("when BP_PHP_NGINX_FRONT_CONTROLLER is set to an empty value", func() {
 				it.Before(func() {
-					Expect(os.Setenv("BP_PHP_ENABLE_HTTPS_REDIRECT", "blah")).To(Succeed())
+					Expect(os.Setenv("BP_PHP_NGINX_FRONT_CONTROLLER", "")).To(Succeed())
 				})
 
 				it.After(func() {
-					Expect(os.Unsetenv("BP_PHP_ENABLE_HTTPS_REDIRECT")).To(Succeed())
+					Expect(os.Unsetenv("BP_PHP_NGINX_FRONT_CONTROLLER")).To(Succeed())
 				})
 
-				it("returns an error", func() {
-					_, err := nginxConfigWriter.Write(workingDir)
-					Expect(err).To(MatchError(ContainSubstring("failed to parse $BP_PHP_ENABLE_HTTPS_REDIRECT into boolean:")))
+				it("does not let the preset turn front controller routing back on", func() {
+					path, err := nginxConfigWriter.Write(workingDir)
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := os.ReadFile(path)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(ContainSubstring(`add_header X-Content-Type-Options "nosniff";`))
+					Expect(string(contents)).NotTo(ContainSubstring("/index.php?$query_string"))
 				})
 			})
+		})
 
-			context("when conf file can't be opened for writing", func() {
+		context("when composer.json cannot be used to detect a framework", func() {
+			var buffer *bytes.Buffer
+
+			it.Before(func() {
+				buffer = bytes.NewBuffer(nil)
+				nginxConfigWriter = phpnginx.NewNginxConfigWriter(scribe.NewEmitter(buffer))
+			})
+
+			it("warns and falls back to htdocs when it cannot be parsed", func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "composer.json"), []byte(`%%%`), 0600)).To(Succeed())
+
+				path, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring(fmt.Sprintf("%s/htdocs;", workingDir)))
+				Expect(buffer.String()).To(ContainSubstring("Warning: no framework detected: failed to parse"))
+			})
+
+			it("warns and falls back to htdocs when it cannot be read", func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "composer.json"), []byte(`{"require": {"laravel/framework": "^11.0"}}`), 0000)).To(Succeed())
+
+				path, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring(fmt.Sprintf("%s/htdocs;", workingDir)))
+				Expect(buffer.String()).To(ContainSubstring("Warning: no framework detected: failed to read"))
+			})
+		})
+
+		context("when a wordpress application is detected", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "composer.json"), []byte(`{"require": {"johnpbloch/wordpress": "^6.0"}}`), 0600)).To(Succeed())
+			})
+
+			it("writes an nginx.conf using the wordpress preset", func() {
+				path, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring(fmt.Sprintf("%s/wordpress;", workingDir)))
+				Expect(string(contents)).To(ContainSubstring("try_files $uri $uri/ /index.php?$query_string;"))
+				Expect(string(contents)).To(ContainSubstring(`        location = /xmlrpc.php {
+            deny all;
+            access_log off;
+            log_not_found off;
+        }`))
+			})
+		})
+
+		context("when a drupal application is detected", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "composer.json"), []byte(`{"require": {"drupal/core-recommended": "^10.0"}}`), 0600)).To(Succeed())
+			})
+
+			it("writes an nginx.conf using the drupal preset", func() {
+				path, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring(fmt.Sprintf("%s/web;", workingDir)))
+				Expect(string(contents)).To(ContainSubstring("try_files $uri $uri/ /index.php?$query_string;"))
+				Expect(string(contents)).To(ContainSubstring(`        location @drupal {
+            rewrite ^ /index.php;
+        }`))
+			})
+		})
+
+		context("when presets are selected", func() {
+			var presetWriter phpnginx.NginxConfigWriter
+
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_NGINX_PRESETS", "laravel,some-preset")).To(Succeed())
+
+				registry := phpnginx.DefaultPresets()
+				registry.Register(somePreset{})
+				presetWriter = nginxConfigWriter.WithPresets(registry)
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_NGINX_PRESETS")).To(Succeed())
+			})
+
+			it("writes an nginx.conf with the preset contributions", func() {
+				path, err := presetWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("try_files $uri $uri/ /index.php?$query_string;"))
+				Expect(string(contents)).To(ContainSubstring(`add_header X-Frame-Options "SAMEORIGIN";`))
+				Expect(string(contents)).To(ContainSubstring(`add_header X-Some-Header "some-value";`))
+				Expect(string(contents)).To(ContainSubstring(`add_header      X-Some-Header "some-value";`))
+				Expect(string(contents)).To(ContainSubstring(`        location = /favicon.ico {
+            access_log off;
+            log_not_found off;
+        }`))
+			})
+		})
+
+		context("when a preset contributes maps and FastCGI params", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_NGINX_PRESETS", "params")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_NGINX_PRESETS")).To(Succeed())
+			})
+
+			it("renders them into the http block and the PHP location", func() {
+				path, err := nginxConfigWriter.WithPresets(phpnginx.NewPresetRegistry(paramsPreset{})).Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring(`    map $http_user_agent $is_bot {
+        default 0;
+        ~*bot 1;
+    }`))
+				Expect(string(contents)).To(ContainSubstring("fastcgi_param  IS_BOT $is_bot;"))
+			})
+		})
+
+		context("when BP_PHP_FPM_LISTEN is a TCP address", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_FPM_LISTEN", "127.0.0.1:9000")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_FPM_LISTEN")).To(Succeed())
+			})
+
+			it("writes an nginx.conf with a TCP upstream", func() {
+				path, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("server 127.0.0.1:9000;"))
+				Expect(string(contents)).NotTo(ContainSubstring("unix:"))
+			})
+		})
+
+		context("when BP_PHP_REQUEST_TIMEOUT is set", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_REQUEST_TIMEOUT", "2m")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_FPM_POOLS", "admin,reports")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_FPM_POOL_ADMIN_PATH", "/admin")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_FPM_POOL_REPORTS_PATH", "/reports")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_FPM_POOL_REPORTS_REQUEST_TIMEOUT", "600")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_REQUEST_TIMEOUT")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_FPM_POOLS")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_FPM_POOL_ADMIN_PATH")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_FPM_POOL_REPORTS_PATH")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_FPM_POOL_REPORTS_REQUEST_TIMEOUT")).To(Succeed())
+			})
+
+			it("times out FastCGI requests after it, unless a pool has its own timeout", func() {
+				path, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("fastcgi_read_timeout 120s;\n            fastcgi_send_timeout 120s;\n            fastcgi_pass    php_fpm;"))
+				Expect(string(contents)).To(ContainSubstring("fastcgi_read_timeout 120s;\n            fastcgi_send_timeout 120s;\n            fastcgi_pass    php_fpm_admin;"))
+				Expect(string(contents)).To(ContainSubstring("fastcgi_read_timeout 600s;\n            fastcgi_send_timeout 600s;\n            fastcgi_pass    php_fpm_reports;"))
+			})
+		})
+
+		context("when the client timeouts are set", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_NGINX_CLIENT_HEADER_TIMEOUT", "10")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_NGINX_CLIENT_BODY_TIMEOUT", "30s")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_NGINX_KEEPALIVE_TIMEOUT", "1m")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_NGINX_CLIENT_HEADER_TIMEOUT")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_NGINX_CLIENT_BODY_TIMEOUT")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_NGINX_KEEPALIVE_TIMEOUT")).To(Succeed())
+			})
+
+			it("writes them into the http block", func() {
+				path, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("keepalive_timeout  60s;\n    client_header_timeout  10s;\n    client_body_timeout  30s;\n"))
+			})
+		})
+
+		context("when BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE is set", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE", "100m")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE")).To(Succeed())
+			})
+
+			it("limits request bodies in the http block", func() {
+				path, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("    client_max_body_size  100m;\n"))
+			})
+		})
+
+		context("when BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE_LOCATIONS is set", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE_LOCATIONS", "/upload=200m, /admin=50M /admin/import/=1g")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_FPM_POOLS", "admin")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_FPM_POOL_ADMIN_PATH", "/admin")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_FPM_POOL_ADMIN_REQUEST_TIMEOUT", "300")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE_LOCATIONS")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_FPM_POOLS")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_FPM_POOL_ADMIN_PATH")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_FPM_POOL_ADMIN_REQUEST_TIMEOUT")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_NGINX_FRONT_CONTROLLER")).To(Succeed())
+			})
+
+			it("limits request bodies per path prefix, in the pool that serves it", func() {
+				path, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).NotTo(ContainSubstring("    client_max_body_size  "))
+				Expect(string(contents)).To(ContainSubstring("location /admin/ {\n            client_max_body_size 50M;\n"))
+				Expect(string(contents)).To(ContainSubstring(`        # allow request bodies of up to 200m under /upload/
+        location /upload/ {
+            client_max_body_size 200m;
+
+        # Allow "Well-Known URIs" as per RFC 8615`))
+				Expect(string(contents)).To(MatchRegexp(`location /upload/ \{[^@]+?fastcgi_pass    php_fpm;`))
+				Expect(string(contents)).To(MatchRegexp(`location /admin/import/ \{\n            client_max_body_size 1g;[^@]+?fastcgi_read_timeout 300s;\n            fastcgi_send_timeout 300s;\n            fastcgi_pass    php_fpm_admin;`))
+			})
+
+			context("when a preset is selected", func() {
 				it.Before(func() {
-					Expect(os.WriteFile(filepath.Join(workingDir, "nginx.conf"), nil, 0400)).To(Succeed())
+					Expect(os.Setenv("BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE_LOCATIONS", "/wp-content/uploads=64m")).To(Succeed())
+					Expect(os.Setenv("BP_PHP_NGINX_PRESETS", "wordpress")).To(Succeed())
 				})
 
-				it("returns an error", func() {
-					_, err := nginxConfigWriter.Write(workingDir)
-					Expect(err).To(MatchError(ContainSubstring("permission denied")))
+				it.After(func() {
+					Expect(os.Unsetenv("BP_PHP_NGINX_PRESETS")).To(Succeed())
+				})
+
+				it("checks the preset's locations before the PHP location under the path", func() {
+					path, err := nginxConfigWriter.Write(workingDir)
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := os.ReadFile(path)
+					Expect(err).NotTo(HaveOccurred())
+
+					_, location, found := strings.Cut(string(contents), "location /wp-content/uploads/ {")
+					Expect(found).To(BeTrue())
+					location, _, _ = strings.Cut(location, "fastcgi_pass    php_fpm;")
+					Expect(location).To(HavePrefix("\n            client_max_body_size 64m;\n"))
+
+					deny := strings.Index(location, `location ~* ^/wp-content/uploads/.*\.php$ {`)
+					php := strings.Index(location, `location ~* \.php(/|$) {`)
+					Expect(deny).To(BeNumerically(">", -1))
+					Expect(php).To(BeNumerically(">", deny))
+				})
+			})
+
+			context("when there is a front controller", func() {
+				it.Before(func() {
+					Expect(os.Setenv("BP_PHP_NGINX_FRONT_CONTROLLER", "index.php")).To(Succeed())
+				})
+
+				it("keeps the limit when falling back to the front controller", func() {
+					path, err := nginxConfigWriter.Write(workingDir)
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := os.ReadFile(path)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(ContainSubstring("location @php_fpm_admin {\n            client_max_body_size 50M;\n"))
+					Expect(string(contents)).To(ContainSubstring("location /upload/ {\n            client_max_body_size 200m;\n            try_files $uri $uri/ @client_max_body_size_0;"))
+					Expect(string(contents)).To(ContainSubstring("location @client_max_body_size_0 {\n            client_max_body_size 200m;\n"))
+					Expect(string(contents)).To(ContainSubstring("location @client_max_body_size_1 {\n            client_max_body_size 1g;\n"))
 				})
 			})
 		})
-	})
 
-	context("nginx-fpm config writer", func() {
-		it("writes an nginx-fpm.conf file into the working dir", func() {
-			path, err := nginxFpmConfigWriter.Write(workingDir)
-			Expect(err).NotTo(HaveOccurred())
+		context("when PHP accepts larger requests than Nginx", func() {
+			var (
+				buffer *bytes.Buffer
+				phprc  string
+			)
 
-			Expect(path).To(Equal(filepath.Join(workingDir, ".php.fpm.bp", "nginx-fpm.conf")))
-			Expect(filepath.Join(workingDir, ".php.fpm.bp", "nginx-fpm.conf")).To(BeARegularFile())
+			it.Before(func() {
+				buffer = bytes.NewBuffer(nil)
+				nginxConfigWriter = phpnginx.NewNginxConfigWriter(scribe.NewEmitter(buffer))
 
-			info, err := os.Stat(path)
-			Expect(err).NotTo(HaveOccurred())
-			Expect(info.Mode().String()).To(Equal("-rw-r-----"))
+				var err error
+				phprc, err = os.MkdirTemp("", "phprc")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(os.WriteFile(filepath.Join(phprc, "php.ini"), []byte("[PHP]\npost_max_size = 8M\nupload_max_filesize = 2M\n"), 0600)).To(Succeed())
+				Expect(os.Setenv("PHPRC", phprc)).To(Succeed())
 
-			contents, err := os.ReadFile(path)
-			Expect(err).NotTo(HaveOccurred())
-			Expect(string(contents)).To(ContainSubstring("listen = /tmp/php-fpm.socket"))
+				Expect(os.MkdirAll(filepath.Join(workingDir, ".php.ini.d"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, ".php.ini.d", "uploads.ini"), []byte("; uploads\nupload_max_filesize = \"64M\" ; per file\n"), 0600)).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("PHPRC")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE_LOCATIONS")).To(Succeed())
+				Expect(os.RemoveAll(phprc)).To(Succeed())
+			})
+
+			it("warns that larger requests are rejected", func() {
+				_, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(buffer.String()).To(ContainSubstring("Warning: Nginx's client_max_body_size (1m) is smaller than PHP's post_max_size (8M) and upload_max_filesize (64M)"))
+				Expect(buffer.String()).To(ContainSubstring("to at least 64M"))
+			})
+
+			it("compares the largest limit of any path", func() {
+				Expect(os.Setenv("BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE", "10m")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE_LOCATIONS", "/upload=32m")).To(Succeed())
+
+				_, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(buffer.String()).To(ContainSubstring("Warning: Nginx's client_max_body_size (32m) is smaller than PHP's upload_max_filesize (64M)"))
+			})
+
+			it("does not warn when Nginx accepts requests as large as PHP", func() {
+				Expect(os.Setenv("BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE_LOCATIONS", "/upload=64m")).To(Succeed())
+
+				_, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(buffer.String()).NotTo(ContainSubstring("Warning"))
+
+				Expect(os.Unsetenv("BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE_LOCATIONS")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE", "0")).To(Succeed())
+
+				_, err = nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(buffer.String()).NotTo(ContainSubstring("Warning"))
+			})
+
+			it("does not warn when no PHP configuration sets the limits", func() {
+				Expect(os.Unsetenv("PHPRC")).To(Succeed())
+				Expect(os.RemoveAll(filepath.Join(workingDir, ".php.ini.d"))).To(Succeed())
+
+				_, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(buffer.String()).NotTo(ContainSubstring("Warning"))
+			})
 		})
 
-		context("failure cases", func() {
+		context("when additional FPM pools are configured", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_FPM_POOLS", "admin")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_FPM_POOL_ADMIN_PATH", "/admin")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_FPM_POOL_ADMIN_REQUEST_TIMEOUT", "300")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_FPM_POOLS")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_FPM_POOL_ADMIN_PATH")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_FPM_POOL_ADMIN_REQUEST_TIMEOUT")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_NGINX_FRONT_CONTROLLER")).To(Succeed())
+			})
+
+			it("writes an upstream and a path-prefix location per pool", func() {
+				path, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("upstream php_fpm_admin {\n        server unix:/tmp/php-fpm-admin.socket;\n    }"))
+				Expect(string(contents)).To(ContainSubstring("location /admin/ {\n\n        # Allow \"Well-Known URIs\""))
+				Expect(string(contents)).To(ContainSubstring("location ~* \\.php$ {\n            try_files $uri =404;\n"))
+				Expect(string(contents)).To(ContainSubstring("fastcgi_read_timeout 300s;\n            fastcgi_send_timeout 300s;\n            fastcgi_pass    php_fpm_admin;"))
+				Expect(string(contents)).To(ContainSubstring("SCRIPT_FILENAME $document_root$fastcgi_script_name;\n            fastcgi_pass    php_fpm;"))
+				Expect(string(contents)).NotTo(ContainSubstring("@php_fpm_admin"))
+			})
+
+			context("when a preset is selected", func() {
+				it.Before(func() {
+					Expect(os.Setenv("BP_PHP_FPM_POOL_ADMIN_PATH", "/core")).To(Succeed())
+					Expect(os.Setenv("BP_PHP_NGINX_PRESETS", "drupal")).To(Succeed())
+				})
+
+				it.After(func() {
+					Expect(os.Unsetenv("BP_PHP_NGINX_PRESETS")).To(Succeed())
+				})
+
+				it("checks the preset's locations before the pool's PHP location", func() {
+					path, err := nginxConfigWriter.Write(workingDir)
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := os.ReadFile(path)
+					Expect(err).NotTo(HaveOccurred())
+
+					_, pool, found := strings.Cut(string(contents), "location /core/ {")
+					Expect(found).To(BeTrue())
+					pool, _, _ = strings.Cut(pool, "fastcgi_pass    php_fpm_admin;")
+
+					deny := strings.Index(pool, `location ~* ^/core/(?!(?:install|authorize)\.php(?:/|$)).*\.php(/|$) {`)
+					hidden := strings.Index(pool, `location ~ /\. {`)
+					php := strings.Index(pool, `location ~* \.php(/|$) {`)
+					Expect(deny).To(BeNumerically(">", -1))
+					Expect(hidden).To(BeNumerically(">", -1))
+					Expect(php).To(BeNumerically(">", deny))
+					Expect(php).To(BeNumerically(">", hidden))
+				})
+			})
+
+			context("when there is a front controller", func() {
+				it.Before(func() {
+					Expect(os.Setenv("BP_PHP_NGINX_FRONT_CONTROLLER", "index.php")).To(Succeed())
+				})
+
+				it("routes unmatched requests under the prefix to the front controller in the pool", func() {
+					path, err := nginxConfigWriter.Write(workingDir)
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := os.ReadFile(path)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(ContainSubstring("location /admin/ {\n            try_files $uri $uri/ @php_fpm_admin;"))
+					Expect(string(contents)).To(ContainSubstring("location @php_fpm_admin {"))
+					Expect(string(contents)).To(ContainSubstring("fastcgi_param  SCRIPT_NAME        /index.php;"))
+					Expect(string(contents)).To(ContainSubstring("fastcgi_param   SCRIPT_FILENAME $document_root/index.php;"))
+				})
+			})
+		})
+
+		context("when BP_PHP_FPM_ENABLE_STATUS is set", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_FPM_ENABLE_STATUS", "true")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_FPM_ENABLE_STATUS")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_FPM_STATUS_ALLOW")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_FPM_STATUS_PORT")).To(Succeed())
+			})
+
+			it("serves the FPM status page and ping to localhost", func() {
+				path, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("location = /fpm-status {\n            if ($fpm_status_allowed = 0) {\n                return 403;\n            }\n            access_log  off;"))
+				Expect(string(contents)).To(ContainSubstring("fastcgi_param  SCRIPT_NAME        /fpm-status;"))
+				Expect(string(contents)).To(ContainSubstring("location = /fpm-ping {"))
+				Expect(string(contents)).To(ContainSubstring("fastcgi_param  SCRIPT_NAME        /fpm-ping;"))
+			})
+
+			it("checks the connection's address rather than the one from X-Forwarded-For", func() {
+				path, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("set_real_ip_from       10.0.0.0/8;"))
+				Expect(string(contents)).To(ContainSubstring("geo $realip_remote_addr $fpm_status_allowed {\n        default  0;\n        127.0.0.1  1;\n        ::1  1;\n    }"))
+				Expect(string(contents)).NotTo(ContainSubstring("allow  127.0.0.1;"))
+				Expect(strings.Count(string(contents), "if ($fpm_status_allowed = 0) {")).To(Equal(2))
+			})
+
+			context("when BP_PHP_FPM_STATUS_ALLOW and BP_PHP_FPM_STATUS_PORT are set", func() {
+				it.Before(func() {
+					Expect(os.Setenv("BP_PHP_FPM_STATUS_ALLOW", "10.0.0.0/8, 127.0.0.1")).To(Succeed())
+					Expect(os.Setenv("BP_PHP_FPM_STATUS_PORT", "9145")).To(Succeed())
+				})
+
+				it("serves them to those addresses on a server of their own", func() {
+					path, err := nginxConfigWriter.Write(workingDir)
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := os.ReadFile(path)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(ContainSubstring("server {\n        listen       9145;\n        server_name localhost;\n\n        # FPM status page and ping, restricted to 10.0.0.0/8, 127.0.0.1\n        location = /fpm-status {\n            if ($fpm_status_allowed = 0) {"))
+					Expect(string(contents)).To(ContainSubstring("geo $realip_remote_addr $fpm_status_allowed {\n        default  0;\n        10.0.0.0/8  1;\n        127.0.0.1  1;\n    }"))
+					Expect(strings.Count(string(contents), "location = /fpm-status")).To(Equal(1))
+				})
+			})
+		})
+
+		context("when BP_PHP_NGINX_ACCESS_LOG_FORMAT is set", func() {
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_NGINX_ACCESS_LOG_FORMAT")).To(Succeed())
+			})
+
+			it("logs in the built-in format of that name", func() {
+				Expect(os.Setenv("BP_PHP_NGINX_ACCESS_LOG_FORMAT", "combined")).To(Succeed())
+				path, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("access_log  /dev/stdout  combined;"))
+				Expect(string(contents)).NotTo(ContainSubstring("log_format combined"))
+			})
+
+			it("logs escaped JSON", func() {
+				Expect(os.Setenv("BP_PHP_NGINX_ACCESS_LOG_FORMAT", "json")).To(Succeed())
+				path, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("log_format json escape=json '{'\n        '\"time\":\"$time_iso8601\",'"))
+				Expect(string(contents)).To(ContainSubstring(`'"status":$status,'`))
+				Expect(string(contents)).To(ContainSubstring(`'"request_time":$request_time,'`))
+				Expect(string(contents)).To(ContainSubstring(`'"upstream_response_time":"$upstream_response_time",'`))
+				Expect(string(contents)).To(ContainSubstring(`'"http_user_agent":"$http_user_agent",'`))
+				Expect(string(contents)).To(ContainSubstring(`'"request_id":"$php_request_id"'`))
+				Expect(string(contents)).To(ContainSubstring("access_log  /dev/stdout  json;"))
+			})
+
+			it("logs in a format string", func() {
+				Expect(os.Setenv("BP_PHP_NGINX_ACCESS_LOG_FORMAT", `$remote_addr 'quoted' \ $status`)).To(Succeed())
+				path, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring(`log_format custom '$remote_addr \'quoted\' \\ $status';`))
+				Expect(string(contents)).To(ContainSubstring("access_log  /dev/stdout  custom;"))
+			})
+		})
+
+		context("when the error log is configured", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_NGINX_ERROR_LOG_LEVEL", "info")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_NGINX_ERROR_LOG_LEVEL")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_NGINX_SERVER_ERROR_LOG")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_NGINX_SERVER_ERROR_LOG_LEVEL")).To(Succeed())
+			})
+
+			it("logs errors at that level", func() {
+				path, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("error_log  stderr  info;"))
+				Expect(strings.Count(string(contents), "error_log")).To(Equal(1))
+			})
+
+			it("logs the server's errors to their own destination", func() {
+				Expect(os.Setenv("BP_PHP_NGINX_SERVER_ERROR_LOG", "syslog:server=127.0.0.1:514,tag=nginx")).To(Succeed())
+				path, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("server_name localhost;\n        error_log    syslog:server=127.0.0.1:514,tag=nginx  info;\n"))
+
+				Expect(os.Setenv("BP_PHP_NGINX_SERVER_ERROR_LOG", "/tmp/server-error.log")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_NGINX_SERVER_ERROR_LOG_LEVEL", "error")).To(Succeed())
+				path, err = nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err = os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("error_log    /tmp/server-error.log  error;"))
+			})
+		})
+
+		context("request IDs", func() {
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_NGINX_REQUEST_ID_HEADER")).To(Succeed())
+			})
+
+			it("reuses the incoming X-Request-ID or generates one, returns it and passes it to FPM", func() {
+				path, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("map $http_x_request_id $php_request_id {\n        default $http_x_request_id;\n        \"\" $request_id;\n    }"))
+				Expect(string(contents)).To(ContainSubstring("        add_header X-Request-ID \"$php_request_id\" always;\n"))
+				Expect(string(contents)).To(ContainSubstring("            add_header      X-Request-ID \"$php_request_id\" always;\n"))
+				Expect(string(contents)).To(ContainSubstring("fastcgi_param  HTTP_X_REQUEST_ID $php_request_id;"))
+			})
+
+			context("when BP_PHP_NGINX_REQUEST_ID_HEADER is set", func() {
+				it.Before(func() {
+					Expect(os.Setenv("BP_PHP_NGINX_REQUEST_ID_HEADER", "X-Correlation-Id")).To(Succeed())
+				})
+
+				it("uses that header instead", func() {
+					path, err := nginxConfigWriter.Write(workingDir)
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := os.ReadFile(path)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(ContainSubstring("map $http_x_correlation_id $php_request_id {\n        default $http_x_correlation_id;"))
+					Expect(string(contents)).To(ContainSubstring(`add_header X-Correlation-Id "$php_request_id" always;`))
+					Expect(string(contents)).To(ContainSubstring("fastcgi_param  HTTP_X_CORRELATION_ID $php_request_id;"))
+					Expect(string(contents)).NotTo(ContainSubstring("X-Request-ID"))
+				})
+			})
+
+			context("when BP_PHP_NGINX_REQUEST_ID_HEADER is invalid", func() {
+				it.Before(func() {
+					Expect(os.Setenv("BP_PHP_NGINX_REQUEST_ID_HEADER", "X Request ID")).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(`failed to parse $BP_PHP_NGINX_REQUEST_ID_HEADER: "X Request ID" is not a header name, such as X-Request-ID`))
+				})
+			})
+		})
+
+		context("when BP_PHP_NGINX_ENABLE_TRACE_CONTEXT is set", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_NGINX_ENABLE_TRACE_CONTEXT", "true")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_NGINX_ENABLE_TRACE_CONTEXT")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_NGINX_ACCESS_LOG_FORMAT")).To(Succeed())
+			})
+
+			it("passes the trace context to FPM and logs the trace ID", func() {
+				path, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring(`map $http_traceparent $php_trace_id {
+        default "";
+        "~^[0-9a-f]{2}-0{32}-" "";
+        "~^(?!ff)[0-9a-f]{2}-([0-9a-f]{32})-[0-9a-f]{16}-[0-9a-f]{2}(-|$)" $1;
+    }`))
+				Expect(string(contents)).To(ContainSubstring("fastcgi_param  HTTP_TRACEPARENT $http_traceparent if_not_empty;\n            fastcgi_param  HTTP_TRACESTATE $http_tracestate if_not_empty;"))
+				Expect(string(contents)).To(ContainSubstring(`request_id=$php_request_id trace_id=$php_trace_id';`))
+			})
+
+			it("adds the trace ID to the JSON access log", func() {
+				Expect(os.Setenv("BP_PHP_NGINX_ACCESS_LOG_FORMAT", "json")).To(Succeed())
+				path, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring(`'"trace_id":"$php_trace_id",'`))
+			})
+		})
+
+		context("when BP_PHP_NGINX_ENABLE_TRACE_CONTEXT is invalid", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_NGINX_ENABLE_TRACE_CONTEXT", "otel")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_NGINX_ENABLE_TRACE_CONTEXT")).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).To(MatchError(ContainSubstring("failed to parse $BP_PHP_NGINX_ENABLE_TRACE_CONTEXT into boolean")))
+			})
+		})
+
+		context("when access log filters are set", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_NGINX_ACCESS_LOG_EXCLUDE_PATHS", "/health, /assets/v1.2/")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_NGINX_ACCESS_LOG_EXCLUDE_USER_AGENTS", `kube-probe, "quoted" agent`)).To(Succeed())
+				Expect(os.Setenv("BP_PHP_NGINX_ACCESS_LOG_EXCLUDE_STATUSES", "3xx,404")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_NGINX_ACCESS_LOG_EXCLUDE_PATHS")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_NGINX_ACCESS_LOG_EXCLUDE_USER_AGENTS")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_NGINX_ACCESS_LOG_EXCLUDE_STATUSES")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_NGINX_ACCESS_LOG_SAMPLE_RATE")).To(Succeed())
+			})
+
+			it("only logs the requests that no filter matches", func() {
+				path, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("access_log  /dev/stdout  extended  if=$loggable;"))
+				Expect(string(contents)).To(ContainSubstring("map $uri $access_log_path {\n        default 1;\n        \"~^/health\" 0;\n        \"~^/assets/v1\\\\.2/\" 0;\n    }"))
+				Expect(string(contents)).To(ContainSubstring("map $http_user_agent $access_log_user_agent {\n        default 1;\n        \"~*kube-probe\" 0;\n        \"~*\\\"quoted\\\" agent\" 0;\n    }"))
+				Expect(string(contents)).To(ContainSubstring("map $status $access_log_status {\n        default 1;\n        ~^3 0;\n        404 0;\n    }"))
+				Expect(string(contents)).To(ContainSubstring("map \"$access_log_path$access_log_user_agent$access_log_status\" $loggable {\n        default 1;\n        ~0 0;\n    }"))
+				Expect(string(contents)).NotTo(ContainSubstring("split_clients"))
+			})
+
+			context("when BP_PHP_NGINX_ACCESS_LOG_SAMPLE_RATE is set", func() {
+				it.Before(func() {
+					Expect(os.Setenv("BP_PHP_NGINX_ACCESS_LOG_SAMPLE_RATE", "12.5")).To(Succeed())
+				})
+
+				it("logs a share of the successful requests and every failed one", func() {
+					path, err := nginxConfigWriter.Write(workingDir)
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := os.ReadFile(path)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(ContainSubstring("split_clients \"${request_id}\" $access_log_sampled {\n        12.5%  1;\n        *  0;\n    }"))
+					Expect(string(contents)).To(ContainSubstring("map $status $access_log_sample {\n        default $access_log_sampled;\n        ~^[45] 1;\n    }"))
+					Expect(string(contents)).To(ContainSubstring("map \"$access_log_path$access_log_user_agent$access_log_status$access_log_sample\" $loggable {"))
+				})
+			})
+
+			context("when BP_PHP_NGINX_ACCESS_LOG_SAMPLE_RATE is 100%", func() {
+				it.Before(func() {
+					Expect(os.Setenv("BP_PHP_NGINX_ACCESS_LOG_SAMPLE_RATE", "100%")).To(Succeed())
+				})
+
+				it("does not sample", func() {
+					path, err := nginxConfigWriter.Write(workingDir)
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := os.ReadFile(path)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).NotTo(ContainSubstring("split_clients"))
+					Expect(string(contents)).NotTo(ContainSubstring("$access_log_sample"))
+				})
+			})
+		})
+
+		context("when BP_PHP_NGINX_ENABLE_ACCESS_LOG is false", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_NGINX_ENABLE_ACCESS_LOG", "false")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_NGINX_ACCESS_LOG_EXCLUDE_PATHS", "/health")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_NGINX_ENABLE_ACCESS_LOG")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_NGINX_ACCESS_LOG_EXCLUDE_PATHS")).To(Succeed())
+			})
+
+			it("turns the access log off", func() {
+				path, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("    access_log  off;\n"))
+				Expect(string(contents)).NotTo(ContainSubstring("/dev/stdout"))
+				Expect(string(contents)).NotTo(ContainSubstring("$loggable"))
+			})
+		})
+
+		context("when BP_PHP_NGINX_ENABLE_METRICS is set", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_NGINX_ENABLE_METRICS", "true")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_NGINX_ENABLE_METRICS")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_FPM_ENABLE_STATUS")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_FPM_STATUS_PATH")).To(Succeed())
+			})
+
+			it("serves the Nginx and FPM status to the exporter on a unix socket", func() {
+				path, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("server {\n        listen       unix:/tmp/php-nginx-status.socket;\n        access_log   off;\n\n        location = /nginx-status {\n            stub_status;\n        }\n\n        location = /fpm-status {"))
+				Expect(string(contents)).To(ContainSubstring("fastcgi_param  SCRIPT_NAME        /fpm-status;"))
+				Expect(string(contents)).NotTo(ContainSubstring("location = /fpm-ping"))
+			})
+
+			context("when the FPM status page is exposed", func() {
+				it.Before(func() {
+					Expect(os.Setenv("BP_PHP_FPM_ENABLE_STATUS", "true")).To(Succeed())
+					Expect(os.Setenv("BP_PHP_FPM_STATUS_PATH", "/status")).To(Succeed())
+				})
+
+				it("reads it from the same path", func() {
+					path, err := nginxConfigWriter.Write(workingDir)
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := os.ReadFile(path)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(ContainSubstring("stub_status;\n        }\n\n        location = /status {"))
+					Expect(strings.Count(string(contents), "location = /status {")).To(Equal(2))
+				})
+			})
+		})
+
+		context("when FPM runs in a separate container", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_FPM_LISTEN", "/tmp/ignored.socket")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_FPM_REMOTE_ADDRESS", "php-fpm:9000")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_FPM_REMOTE_ROOT", "/var/www/html/public/")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_FPM_LISTEN")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_FPM_REMOTE_ADDRESS")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_FPM_REMOTE_ROOT")).To(Succeed())
+			})
+
+			it("writes an nginx.conf that proxies to the remote FPM with its document root", func() {
+				path, err := nginxConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("server php-fpm:9000;"))
+				Expect(string(contents)).To(ContainSubstring("fastcgi_param  DOCUMENT_ROOT      /var/www/html/public;"))
+				Expect(string(contents)).To(ContainSubstring("fastcgi_param   SCRIPT_FILENAME /var/www/html/public$fastcgi_script_name;"))
+				Expect(string(contents)).To(ContainSubstring(fmt.Sprintf("root               %s/htdocs;", workingDir)))
+			})
+		})
+
+		context("failure cases", func() {
+			context("when BP_PHP_FPM_REMOTE_ADDRESS is invalid", func() {
+				it.Before(func() {
+					Expect(os.Setenv("BP_PHP_FPM_REMOTE_ADDRESS", "php-fpm")).To(Succeed())
+				})
+
+				it.After(func() {
+					Expect(os.Unsetenv("BP_PHP_FPM_REMOTE_ADDRESS")).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(ContainSubstring("failed to parse $BP_PHP_FPM_REMOTE_ADDRESS")))
+				})
+			})
+
+			context("when a timeout is invalid", func() {
+				it.After(func() {
+					Expect(os.Unsetenv("BP_PHP_REQUEST_TIMEOUT")).To(Succeed())
+					Expect(os.Unsetenv("BP_PHP_NGINX_KEEPALIVE_TIMEOUT")).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					Expect(os.Setenv("BP_PHP_REQUEST_TIMEOUT", "forever")).To(Succeed())
+
+					_, err := nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(`failed to parse $BP_PHP_REQUEST_TIMEOUT: "forever" is not a number of seconds or a duration`))
+
+					_, err = nginxFpmConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(`failed to parse $BP_PHP_REQUEST_TIMEOUT: "forever" is not a number of seconds or a duration`))
+
+					Expect(os.Unsetenv("BP_PHP_REQUEST_TIMEOUT")).To(Succeed())
+					Expect(os.Setenv("BP_PHP_NGINX_KEEPALIVE_TIMEOUT", "0")).To(Succeed())
+
+					_, err = nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(`failed to parse $BP_PHP_NGINX_KEEPALIVE_TIMEOUT: "0" must be at least one second`))
+				})
+			})
+
+			context("when a request body size is invalid", func() {
+				it.After(func() {
+					Expect(os.Unsetenv("BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE")).To(Succeed())
+					Expect(os.Unsetenv("BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE_LOCATIONS")).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					Expect(os.Setenv("BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE", "big")).To(Succeed())
+					_, err := nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(`failed to parse $BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE: "big" is not a size such as 100m`))
+					Expect(os.Unsetenv("BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE")).To(Succeed())
+
+					Expect(os.Setenv("BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE_LOCATIONS", "/upload")).To(Succeed())
+					_, err = nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(`failed to parse $BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE_LOCATIONS: "/upload" is not a <path>=<size> pair`))
+
+					Expect(os.Setenv("BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE_LOCATIONS", "upload=10m")).To(Succeed())
+					_, err = nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(`failed to parse $BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE_LOCATIONS: "upload" must be a path starting with "/"`))
+
+					Expect(os.Setenv("BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE_LOCATIONS", "/upload=10mb")).To(Succeed())
+					_, err = nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(`failed to parse $BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE_LOCATIONS: "10mb" is not a size such as 100m`))
+
+					Expect(os.Setenv("BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE_LOCATIONS", "/upload=10m,/upload/=20m")).To(Succeed())
+					_, err = nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(`failed to parse $BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE_LOCATIONS: "/upload/" is listed more than once`))
+
+					Expect(os.Setenv("BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE_LOCATIONS", "/=20m")).To(Succeed())
+					_, err = nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(`failed to parse $BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE_LOCATIONS: "/" is the whole site, whose limit is set through $BP_PHP_NGINX_CLIENT_MAX_BODY_SIZE`))
+				})
+			})
+
+			context("when the FPM status endpoints are invalid", func() {
+				it.Before(func() {
+					Expect(os.Setenv("BP_PHP_FPM_ENABLE_STATUS", "true")).To(Succeed())
+				})
+
+				it.After(func() {
+					Expect(os.Unsetenv("BP_PHP_FPM_ENABLE_STATUS")).To(Succeed())
+					Expect(os.Unsetenv("BP_PHP_FPM_STATUS_PATH")).To(Succeed())
+					Expect(os.Unsetenv("BP_PHP_FPM_PING_PATH")).To(Succeed())
+					Expect(os.Unsetenv("BP_PHP_FPM_STATUS_ALLOW")).To(Succeed())
+					Expect(os.Unsetenv("BP_PHP_FPM_STATUS_PORT")).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					Expect(os.Setenv("BP_PHP_FPM_ENABLE_STATUS", "yes please")).To(Succeed())
+					_, err := nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(ContainSubstring("failed to parse $BP_PHP_FPM_ENABLE_STATUS into boolean")))
+					Expect(os.Setenv("BP_PHP_FPM_ENABLE_STATUS", "true")).To(Succeed())
+
+					Expect(os.Setenv("BP_PHP_FPM_STATUS_PATH", "status")).To(Succeed())
+					_, err = nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(`failed to parse $BP_PHP_FPM_STATUS_PATH: "status" must be a path starting with "/"`))
+
+					Expect(os.Setenv("BP_PHP_FPM_STATUS_PATH", "/status")).To(Succeed())
+					Expect(os.Setenv("BP_PHP_FPM_PING_PATH", "/status")).To(Succeed())
+					_, err = nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(`failed to parse $BP_PHP_FPM_PING_PATH: "/status" is already the status path`))
+					Expect(os.Unsetenv("BP_PHP_FPM_PING_PATH")).To(Succeed())
+
+					Expect(os.Setenv("BP_PHP_FPM_STATUS_ALLOW", "10.0.0.0/33")).To(Succeed())
+					_, err = nginxFpmConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(`failed to parse $BP_PHP_FPM_STATUS_ALLOW: "10.0.0.0/33" is not an IP address or a CIDR range`))
+					Expect(os.Unsetenv("BP_PHP_FPM_STATUS_ALLOW")).To(Succeed())
+
+					Expect(os.Setenv("BP_PHP_FPM_STATUS_PORT", "70000")).To(Succeed())
+					_, err = nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(`failed to parse $BP_PHP_FPM_STATUS_PORT: "70000" is not a port number`))
+				})
+			})
+
+			context("when BP_PHP_NGINX_ACCESS_LOG_FORMAT is invalid", func() {
+				it.After(func() {
+					Expect(os.Unsetenv("BP_PHP_NGINX_ACCESS_LOG_FORMAT")).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					Expect(os.Setenv("BP_PHP_NGINX_ACCESS_LOG_FORMAT", "jsonl")).To(Succeed())
+					_, err := nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(`failed to parse $BP_PHP_NGINX_ACCESS_LOG_FORMAT: "jsonl" is neither one of common, combined, extended, json nor a format string with Nginx variables`))
+
+					Expect(os.Setenv("BP_PHP_NGINX_ACCESS_LOG_FORMAT", "$remote_addr\n$status")).To(Succeed())
+					_, err = nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError("failed to parse $BP_PHP_NGINX_ACCESS_LOG_FORMAT: the format string must be a single line"))
+				})
+			})
+
+			context("when the error log is invalid", func() {
+				it.After(func() {
+					Expect(os.Unsetenv("BP_PHP_NGINX_ERROR_LOG_LEVEL")).To(Succeed())
+					Expect(os.Unsetenv("BP_PHP_NGINX_SERVER_ERROR_LOG")).To(Succeed())
+					Expect(os.Unsetenv("BP_PHP_NGINX_SERVER_ERROR_LOG_LEVEL")).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					Expect(os.Setenv("BP_PHP_NGINX_ERROR_LOG_LEVEL", "warning")).To(Succeed())
+					_, err := nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(`failed to parse $BP_PHP_NGINX_ERROR_LOG_LEVEL: "warning" is not one of debug, info, notice, warn, error, crit, alert, emerg`))
+					Expect(os.Unsetenv("BP_PHP_NGINX_ERROR_LOG_LEVEL")).To(Succeed())
+
+					Expect(os.Setenv("BP_PHP_NGINX_SERVER_ERROR_LOG_LEVEL", "error")).To(Succeed())
+					_, err = nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError("failed to parse $BP_PHP_NGINX_SERVER_ERROR_LOG_LEVEL: $BP_PHP_NGINX_SERVER_ERROR_LOG must be set as well"))
+
+					Expect(os.Setenv("BP_PHP_NGINX_SERVER_ERROR_LOG", "logs/error.log")).To(Succeed())
+					_, err = nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(`failed to parse $BP_PHP_NGINX_SERVER_ERROR_LOG: "logs/error.log" is not "stderr", a syslog server or an absolute path`))
+				})
+			})
+
+			context("when an access log filter is invalid", func() {
+				it.After(func() {
+					Expect(os.Unsetenv("BP_PHP_NGINX_ENABLE_ACCESS_LOG")).To(Succeed())
+					Expect(os.Unsetenv("BP_PHP_NGINX_ACCESS_LOG_EXCLUDE_PATHS")).To(Succeed())
+					Expect(os.Unsetenv("BP_PHP_NGINX_ACCESS_LOG_EXCLUDE_USER_AGENTS")).To(Succeed())
+					Expect(os.Unsetenv("BP_PHP_NGINX_ACCESS_LOG_EXCLUDE_STATUSES")).To(Succeed())
+					Expect(os.Unsetenv("BP_PHP_NGINX_ACCESS_LOG_SAMPLE_RATE")).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					Expect(os.Setenv("BP_PHP_NGINX_ENABLE_ACCESS_LOG", "nope")).To(Succeed())
+					_, err := nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(ContainSubstring("failed to parse $BP_PHP_NGINX_ENABLE_ACCESS_LOG into boolean")))
+					Expect(os.Unsetenv("BP_PHP_NGINX_ENABLE_ACCESS_LOG")).To(Succeed())
+
+					Expect(os.Setenv("BP_PHP_NGINX_ACCESS_LOG_EXCLUDE_PATHS", "health")).To(Succeed())
+					_, err = nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(`failed to parse $BP_PHP_NGINX_ACCESS_LOG_EXCLUDE_PATHS: "health" must be a path starting with "/"`))
+					Expect(os.Unsetenv("BP_PHP_NGINX_ACCESS_LOG_EXCLUDE_PATHS")).To(Succeed())
+
+					Expect(os.Setenv("BP_PHP_NGINX_ACCESS_LOG_EXCLUDE_USER_AGENTS", "kube-(probe")).To(Succeed())
+					_, err = nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(`failed to parse $BP_PHP_NGINX_ACCESS_LOG_EXCLUDE_USER_AGENTS: "kube-(probe" is not a regular expression`))
+					Expect(os.Unsetenv("BP_PHP_NGINX_ACCESS_LOG_EXCLUDE_USER_AGENTS")).To(Succeed())
+
+					Expect(os.Setenv("BP_PHP_NGINX_ACCESS_LOG_EXCLUDE_STATUSES", "2XX")).To(Succeed())
+					_, err = nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(`failed to parse $BP_PHP_NGINX_ACCESS_LOG_EXCLUDE_STATUSES: "2XX" is not a status code, such as 404, or class, such as 2xx`))
+					Expect(os.Unsetenv("BP_PHP_NGINX_ACCESS_LOG_EXCLUDE_STATUSES")).To(Succeed())
+
+					Expect(os.Setenv("BP_PHP_NGINX_ACCESS_LOG_SAMPLE_RATE", "0")).To(Succeed())
+					_, err = nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(`failed to parse $BP_PHP_NGINX_ACCESS_LOG_SAMPLE_RATE: "0" is not a percentage between 0 and 100, such as 10%`))
+
+					Expect(os.Setenv("BP_PHP_NGINX_ACCESS_LOG_SAMPLE_RATE", "1.125%")).To(Succeed())
+					_, err = nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(`failed to parse $BP_PHP_NGINX_ACCESS_LOG_SAMPLE_RATE: "1.125%" has more than two decimal places`))
+				})
+			})
+
+			context("when the metrics exporter is invalid", func() {
+				it.After(func() {
+					Expect(os.Unsetenv("BP_PHP_NGINX_ENABLE_METRICS")).To(Succeed())
+					Expect(os.Unsetenv("BP_PHP_NGINX_METRICS_PORT")).To(Succeed())
+					Expect(os.Unsetenv("BP_PHP_FPM_ENABLE_STATUS")).To(Succeed())
+					Expect(os.Unsetenv("BP_PHP_FPM_STATUS_PORT")).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					Expect(os.Setenv("BP_PHP_NGINX_ENABLE_METRICS", "sure")).To(Succeed())
+					_, err := nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(ContainSubstring("failed to parse $BP_PHP_NGINX_ENABLE_METRICS into boolean")))
+
+					Expect(os.Setenv("BP_PHP_NGINX_ENABLE_METRICS", "true")).To(Succeed())
+					Expect(os.Setenv("BP_PHP_NGINX_METRICS_PORT", "metrics")).To(Succeed())
+					_, err = nginxFpmConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(`failed to parse $BP_PHP_NGINX_METRICS_PORT: "metrics" is not a port number`))
+
+					Expect(os.Setenv("BP_PHP_NGINX_METRICS_PORT", "9145")).To(Succeed())
+					Expect(os.Setenv("BP_PHP_FPM_ENABLE_STATUS", "true")).To(Succeed())
+					Expect(os.Setenv("BP_PHP_FPM_STATUS_PORT", "9145")).To(Succeed())
+					_, err = nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError("failed to parse $BP_PHP_NGINX_METRICS_PORT: 9145 is already the FPM status port"))
+				})
+			})
+
+			context("when an FPM pool is invalid", func() {
+				it.Before(func() {
+					Expect(os.Setenv("BP_PHP_FPM_POOLS", "admin")).To(Succeed())
+				})
+
+				it.After(func() {
+					Expect(os.Unsetenv("BP_PHP_FPM_POOLS")).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(ContainSubstring("failed to parse $BP_PHP_FPM_POOL_ADMIN_PATH")))
+
+					_, err = nginxFpmConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(ContainSubstring("failed to parse $BP_PHP_FPM_POOL_ADMIN_PATH")))
+				})
+
+				context("when its path would render a second location for the same prefix", func() {
+					it.After(func() {
+						Expect(os.Unsetenv("BP_PHP_FPM_POOL_ADMIN_PATH")).To(Succeed())
+						Expect(os.Unsetenv("BP_PHP_FPM_POOL_API_PATH")).To(Succeed())
+						Expect(os.Unsetenv("BP_PHP_NGINX_FRONT_CONTROLLER")).To(Succeed())
+					})
+
+					it("returns an error", func() {
+						Expect(os.Setenv("BP_PHP_FPM_POOLS", "admin,api")).To(Succeed())
+						Expect(os.Setenv("BP_PHP_FPM_POOL_ADMIN_PATH", "/admin")).To(Succeed())
+						Expect(os.Setenv("BP_PHP_FPM_POOL_API_PATH", "/admin/")).To(Succeed())
+						_, err := nginxConfigWriter.Write(workingDir)
+						Expect(err).To(MatchError(`failed to parse $BP_PHP_FPM_POOL_API_PATH: "/admin/" is already the path of another pool`))
+
+						Expect(os.Setenv("BP_PHP_FPM_POOLS", "admin")).To(Succeed())
+						Expect(os.Setenv("BP_PHP_FPM_POOL_ADMIN_PATH", "/")).To(Succeed())
+						Expect(os.Setenv("BP_PHP_NGINX_FRONT_CONTROLLER", "index.php")).To(Succeed())
+						_, err = nginxConfigWriter.Write(workingDir)
+						Expect(err).To(MatchError(`failed to parse $BP_PHP_FPM_POOL_ADMIN_PATH: "/" would serve the whole site from the pool instead of the www pool`))
+					})
+				})
+			})
+
+			context("when BP_PHP_FPM_REMOTE_ROOT is relative", func() {
+				it.Before(func() {
+					Expect(os.Setenv("BP_PHP_FPM_REMOTE_ROOT", "public")).To(Succeed())
+				})
+
+				it.After(func() {
+					Expect(os.Unsetenv("BP_PHP_FPM_REMOTE_ROOT")).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(`failed to parse $BP_PHP_FPM_REMOTE_ROOT: "public" must be an absolute path`))
+				})
+			})
+
+			context("when BP_PHP_FPM_LISTEN is invalid", func() {
+				it.Before(func() {
+					Expect(os.Setenv("BP_PHP_FPM_LISTEN", "not-an-address")).To(Succeed())
+				})
+
+				it.After(func() {
+					Expect(os.Unsetenv("BP_PHP_FPM_LISTEN")).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(ContainSubstring("failed to parse $BP_PHP_FPM_LISTEN")))
+				})
+			})
+
+			context("when an unknown preset is selected", func() {
+				it.Before(func() {
+					Expect(os.Setenv("BP_PHP_NGINX_PRESETS", "unknown-preset")).To(Succeed())
+				})
+
+				it.After(func() {
+					Expect(os.Unsetenv("BP_PHP_NGINX_PRESETS")).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(ContainSubstring(`failed to parse $BP_PHP_NGINX_PRESETS: unknown Nginx preset "unknown-preset"`)))
+				})
+			})
+
+			context("when a preset fails to apply", func() {
+				it.Before(func() {
+					Expect(os.Setenv("BP_PHP_NGINX_PRESETS", "failing")).To(Succeed())
+				})
+
+				it.After(func() {
+					Expect(os.Unsetenv("BP_PHP_NGINX_PRESETS")).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := nginxConfigWriter.WithPresets(phpnginx.NewPresetRegistry(failingPreset{})).Write(workingDir)
+					Expect(err).To(MatchError(`failed to apply Nginx preset "failing": some preset error`))
+				})
+			})
+
+			context("when the BP_PHP_NGINX_INDEX value is empty", func() {
+				it.Before(func() {
+					Expect(os.Setenv("BP_PHP_NGINX_INDEX", " , ")).To(Succeed())
+				})
+
+				it.After(func() {
+					Expect(os.Unsetenv("BP_PHP_NGINX_INDEX")).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(ContainSubstring("failed to parse $BP_PHP_NGINX_INDEX")))
+				})
+			})
+
+			context("when the BP_PHP_NGINX_ENABLE_HTTPS value cannot be parsed into a bool", func() {
+				it.Before(func() {
+					Expect(os.Setenv("BP_PHP_NGINX_ENABLE_HTTPS", "blah")).To(Succeed())
+				})
+
+				it.After(func() {
+					Expect(os.Unsetenv("BP_PHP_NGINX_ENABLE_HTTPS")).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(ContainSubstring("failed to parse $BP_PHP_NGINX_ENABLE_HTTPS into boolean:")))
+				})
+			})
+
+			context("when the BP_PHP_ENABLE_HTTPS_REDIRECT value cannot be parsed into a bool", func() {
+				it.Before(func() {
+					Expect(os.Setenv("BP_PHP_ENABLE_HTTPS_REDIRECT", "blah")).To(Succeed())
+				})
+
+				it.After(func() {
+					Expect(os.Unsetenv("BP_PHP_ENABLE_HTTPS_REDIRECT")).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(ContainSubstring("failed to parse $BP_PHP_ENABLE_HTTPS_REDIRECT into boolean:")))
+				})
+			})
+
+			context("when conf file can't be opened for writing", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(workingDir, "nginx.conf"), nil, 0400)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := nginxConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(ContainSubstring("permission denied")))
+				})
+			})
+		})
+	})
+
+	context("nginx-fpm config writer", func() {
+		it("writes an nginx-fpm.conf file into the working dir", func() {
+			path, err := nginxFpmConfigWriter.Write(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(path).To(Equal(filepath.Join(workingDir, ".php.fpm.bp", "nginx-fpm.conf")))
+			Expect(filepath.Join(workingDir, ".php.fpm.bp", "nginx-fpm.conf")).To(BeARegularFile())
+
+			info, err := os.Stat(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().String()).To(Equal("-rw-rw----"))
+
+			contents, err := os.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring("listen = /tmp/php-fpm.socket"))
+			Expect(string(contents)).NotTo(ContainSubstring("pm ="))
+		})
+
+		it("saves the configuration next to the nginx-fpm.conf file for launch-time rendering", func() {
+			path, err := nginxFpmConfigWriter.Write(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+
+			savedPath := phpnginx.SavedNginxConfigPath(path)
+			Expect(savedPath).To(Equal(filepath.Join(workingDir, ".php.fpm.bp", ".nginx-fpm.conf.json")))
+
+			info, err := os.Stat(savedPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().String()).To(Equal("-rw-rw----"))
+		})
+
+		context("when BP_PHP_FPM_LISTEN is set", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_FPM_LISTEN", "9000")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_FPM_LISTEN")).To(Succeed())
+			})
+
+			it("writes an nginx-fpm.conf listening on that address", func() {
+				path, err := nginxFpmConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("listen = 127.0.0.1:9000"))
+			})
+		})
+
+		context("when additional FPM pools are configured", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_FPM_POOLS", "admin")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_FPM_POOL_ADMIN_PATH", "/admin")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_FPM_POOL_ADMIN_MAX_CHILDREN", "2")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_FPM_POOL_ADMIN_REQUEST_TIMEOUT", "300")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_FPM_POOLS")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_FPM_POOL_ADMIN_PATH")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_FPM_POOL_ADMIN_MAX_CHILDREN")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_FPM_POOL_ADMIN_REQUEST_TIMEOUT")).To(Succeed())
+			})
+
+			it("writes a section per pool with its own socket", func() {
+				path, err := nginxFpmConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("[www]\n\nlisten = /tmp/php-fpm.socket"))
+				Expect(string(contents)).To(ContainSubstring(`[admin]
+
+listen = /tmp/php-fpm-admin.socket
+pm = ondemand
+pm.max_children = 2
+pm.process_idle_timeout = 10s
+clear_env = no
+request_terminate_timeout = 300s`))
+			})
+		})
+
+		context("when BP_PHP_FPM_ENABLE_STATUS is set", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_FPM_ENABLE_STATUS", "true")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_FPM_PING_RESPONSE", "ok")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_FPM_ENABLE_STATUS")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_FPM_PING_RESPONSE")).To(Succeed())
+			})
+
+			it("enables the status page and ping of the www pool", func() {
+				path, err := nginxFpmConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("listen = /tmp/php-fpm.socket\npm.status_path = /fpm-status\nping.path = /fpm-ping\nping.response = ok\n"))
+			})
+		})
+
+		context("when BP_PHP_NGINX_ENABLE_METRICS is set", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_NGINX_ENABLE_METRICS", "true")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_NGINX_ENABLE_METRICS")).To(Succeed())
+			})
+
+			it("enables the status page of the www pool for the exporter", func() {
+				path, err := nginxFpmConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("listen = /tmp/php-fpm.socket\npm.status_path = /fpm-status\n"))
+				Expect(string(contents)).NotTo(ContainSubstring("ping.path"))
+			})
+		})
+
+		context("when BP_PHP_REQUEST_TIMEOUT is set", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_REQUEST_TIMEOUT", "90")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_FPM_POOLS", "admin")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_FPM_POOL_ADMIN_PATH", "/admin")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_REQUEST_TIMEOUT")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_FPM_POOLS")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_FPM_POOL_ADMIN_PATH")).To(Succeed())
+			})
+
+			it("terminates requests in every pool after it", func() {
+				path, err := nginxFpmConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("[www]\n\nlisten = /tmp/php-fpm.socket\nrequest_terminate_timeout = 90s\n"))
+				Expect(string(contents)).To(ContainSubstring("clear_env = no\nrequest_terminate_timeout = 90s"))
+			})
+		})
+
+		context("when FPM runs in a separate container", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_FPM_REMOTE_ADDRESS", "php-fpm:9000")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_FPM_REMOTE_ADDRESS")).To(Succeed())
+			})
+
+			it("writes an nginx-fpm.conf listening on the remote port on all interfaces", func() {
+				path, err := nginxFpmConfigWriter.Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := os.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("listen = 0.0.0.0:9000"))
+			})
+		})
+
+		context("failure cases", func() {
+			context("when BP_PHP_FPM_LISTEN is invalid", func() {
+				it.Before(func() {
+					Expect(os.Setenv("BP_PHP_FPM_LISTEN", "unix:relative.socket")).To(Succeed())
+				})
+
+				it.After(func() {
+					Expect(os.Unsetenv("BP_PHP_FPM_LISTEN")).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := nginxFpmConfigWriter.Write(workingDir)
+					Expect(err).To(MatchError(ContainSubstring("failed to parse $BP_PHP_FPM_LISTEN")))
+				})
+			})
+
 			context("when conf file can't be opened for writing", func() {
 				it.Before(func() {
 					Expect(os.WriteFile(filepath.Join(workingDir, ".php.fpm.bp", "nginx-fpm.conf"), nil, 0400)).To(Succeed())
@@ -3,4 +3,9 @@ package phpnginx
 const (
 	PhpNginxConfigLayer = "php-nginx-config"
 	PhpNginxConfig      = "php-nginx-config"
+	Nginx               = "nginx"
+	LauncherLayer       = "php-nginx-launcher"
+	LauncherExecutable  = "php-nginx-launcher"
+	RenderExecutable    = "php-nginx-render"
+	ExporterExecutable  = "php-nginx-exporter"
 )
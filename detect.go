@@ -1,11 +1,19 @@
 package phpnginx
 
 import (
+	"fmt"
 	"os"
+	"strconv"
 
 	"github.com/paketo-buildpacks/packit/v2"
 )
 
+// BuildPlanMetadata is the buildpack-specific data included in build plan
+// requirements.
+type BuildPlanMetadata struct {
+	Build bool `toml:"build"`
+}
+
 func Detect() packit.DetectFunc {
 	return func(context packit.DetectContext) (packit.DetectResult, error) {
 
@@ -14,9 +22,25 @@ func Detect() packit.DetectFunc {
 			return packit.DetectResult{}, packit.Fail.WithMessage("BP_PHP_SERVER is not set to 'nginx'")
 		}
 
+		requires := []packit.BuildPlanRequirement{}
+
+		// validating the configuration with `nginx -t` needs nginx at build-time
+		validate, err := parseValidate()
+		if err != nil {
+			return packit.DetectResult{}, err
+		}
+		if validate {
+			requires = append(requires, packit.BuildPlanRequirement{
+				Name: Nginx,
+				Metadata: BuildPlanMetadata{
+					Build: true,
+				},
+			})
+		}
+
 		return packit.DetectResult{
 			Plan: packit.BuildPlan{
-				Requires: []packit.BuildPlanRequirement{},
+				Requires: requires,
 				Provides: []packit.BuildPlanProvision{
 					{
 						Name: PhpNginxConfig,
@@ -26,3 +50,17 @@ func Detect() packit.DetectFunc {
 		}, nil
 	}
 }
+
+func parseValidate() (bool, error) {
+	validateStr, ok := os.LookupEnv("BP_PHP_NGINX_VALIDATE")
+	if !ok {
+		return false, nil
+	}
+
+	validate, err := strconv.ParseBool(validateStr)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse $BP_PHP_NGINX_VALIDATE into boolean: %w", err)
+	}
+
+	return validate, nil
+}
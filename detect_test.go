@@ -55,6 +55,53 @@ func testDetect(t *testing.T, context spec.G, it spec.S) {
 		})
 	})
 
+	context("$BP_PHP_NGINX_VALIDATE is set to true", func() {
+		it.Before(func() {
+			Expect(os.Setenv("BP_PHP_SERVER", "nginx")).To(Succeed())
+			Expect(os.Setenv("BP_PHP_NGINX_VALIDATE", "true")).To(Succeed())
+		})
+		it.After(func() {
+			Expect(os.Unsetenv("BP_PHP_SERVER")).To(Succeed())
+			Expect(os.Unsetenv("BP_PHP_NGINX_VALIDATE")).To(Succeed())
+		})
+
+		it("requires nginx at build-time", func() {
+			result, err := detect(packit.DetectContext{
+				WorkingDir: workingDir,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(result.Plan).To(Equal(packit.BuildPlan{
+				Requires: []packit.BuildPlanRequirement{
+					{
+						Name: phpnginx.Nginx,
+						Metadata: phpnginx.BuildPlanMetadata{
+							Build: true,
+						},
+					},
+				},
+				Provides: []packit.BuildPlanProvision{
+					{
+						Name: phpnginx.PhpNginxConfig,
+					},
+				},
+			}))
+		})
+
+		context("when $BP_PHP_NGINX_VALIDATE cannot be parsed into a bool", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_NGINX_VALIDATE", "blah")).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := detect(packit.DetectContext{
+					WorkingDir: workingDir,
+				})
+				Expect(err).To(MatchError(ContainSubstring("failed to parse $BP_PHP_NGINX_VALIDATE into boolean:")))
+			})
+		})
+	})
+
 	context("$BP_PHP_SERVER is not set to nginx", func() {
 		it("detection fails", func() {
 			_, err := detect(packit.DetectContext{
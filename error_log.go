@@ -0,0 +1,89 @@
+package phpnginx
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultErrorLogLevel is the error log level in effect when
+// $BP_PHP_NGINX_ERROR_LOG_LEVEL is not set.
+const defaultErrorLogLevel = "notice"
+
+// errorLogLevels are the levels of Nginx's error_log, from the most to the
+// least verbose.
+var errorLogLevels = []string{"debug", "info", "notice", "warn", "error", "crit", "alert", "emerg"}
+
+// NginxErrorLog is the level of the error log written to stderr, and the
+// optional error log of the server block.
+type NginxErrorLog struct {
+	Level string
+
+	// ServerDestination, when set, is where the server block writes its
+	// errors instead, and ServerLevel their level, which defaults to Level.
+	ServerDestination string
+	ServerLevel       string
+}
+
+// LoadErrorLog returns the error log configured through
+// $BP_PHP_NGINX_ERROR_LOG_LEVEL, $BP_PHP_NGINX_SERVER_ERROR_LOG and
+// $BP_PHP_NGINX_SERVER_ERROR_LOG_LEVEL.
+func LoadErrorLog() (NginxErrorLog, error) {
+	errorLog := NginxErrorLog{Level: defaultErrorLogLevel}
+
+	var err error
+	if value, ok := os.LookupEnv("BP_PHP_NGINX_ERROR_LOG_LEVEL"); ok {
+		errorLog.Level, err = parseErrorLogLevel(value)
+		if err != nil {
+			return NginxErrorLog{}, fmt.Errorf("failed to parse $BP_PHP_NGINX_ERROR_LOG_LEVEL: %w", err)
+		}
+	}
+
+	if value, ok := os.LookupEnv("BP_PHP_NGINX_SERVER_ERROR_LOG"); ok {
+		errorLog.ServerDestination, err = parseErrorLogDestination(value)
+		if err != nil {
+			return NginxErrorLog{}, fmt.Errorf("failed to parse $BP_PHP_NGINX_SERVER_ERROR_LOG: %w", err)
+		}
+	}
+
+	if value, ok := os.LookupEnv("BP_PHP_NGINX_SERVER_ERROR_LOG_LEVEL"); ok {
+		if errorLog.ServerDestination == "" {
+			return NginxErrorLog{}, fmt.Errorf("failed to parse $BP_PHP_NGINX_SERVER_ERROR_LOG_LEVEL: $BP_PHP_NGINX_SERVER_ERROR_LOG must be set as well")
+		}
+
+		errorLog.ServerLevel, err = parseErrorLogLevel(value)
+		if err != nil {
+			return NginxErrorLog{}, fmt.Errorf("failed to parse $BP_PHP_NGINX_SERVER_ERROR_LOG_LEVEL: %w", err)
+		}
+	}
+
+	return errorLog, nil
+}
+
+// parseErrorLogLevel checks that value is one of Nginx's error log levels.
+func parseErrorLogLevel(value string) (string, error) {
+	level := strings.ToLower(strings.TrimSpace(value))
+	for _, name := range errorLogLevels {
+		if level == name {
+			return level, nil
+		}
+	}
+
+	return "", fmt.Errorf("%q is not one of %s", value, strings.Join(errorLogLevels, ", "))
+}
+
+// parseErrorLogDestination checks that value is "stderr", a syslog server
+// such as "syslog:server=127.0.0.1", or an absolute file path.
+func parseErrorLogDestination(value string) (string, error) {
+	destination := strings.TrimSpace(value)
+	if destination == "" || strings.ContainsAny(destination, " \t\r\n;{}'\"") {
+		return "", fmt.Errorf("%q is not \"stderr\", a syslog server or an absolute path", value)
+	}
+
+	if destination == "stderr" || strings.HasPrefix(destination, "syslog:") || filepath.IsAbs(destination) {
+		return destination, nil
+	}
+
+	return "", fmt.Errorf("%q is not \"stderr\", a syslog server or an absolute path", value)
+}
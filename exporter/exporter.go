@@ -0,0 +1,259 @@
+package exporter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NginxStatusPath is where Nginx serves its stub_status on the status socket.
+const NginxStatusPath = "/nginx-status"
+
+// scrapeTimeout bounds how long a scrape of Nginx or FPM may take, so that a
+// busy FPM cannot hold up the whole /metrics response.
+const scrapeTimeout = 5 * time.Second
+
+// Exporter serves the metrics of Nginx and FPM in the Prometheus text format.
+// It reads Nginx's stub_status and the JSON status page of FPM's www pool
+// from the server Nginx runs on a unix socket for it, on every request.
+type Exporter struct {
+	client        *http.Client
+	fpmStatusPath string
+	logs          io.Writer
+}
+
+// NewExporter returns an Exporter that reads the statuses from the server on
+// socket, with FPM's at fpmStatusPath. Scrapes that fail are logged to logs.
+func NewExporter(socket, fpmStatusPath string, logs io.Writer) Exporter {
+	var dialer net.Dialer
+	return Exporter{
+		client: &http.Client{
+			Timeout: scrapeTimeout,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+		fpmStatusPath: fpmStatusPath,
+		logs:          logs,
+	}
+}
+
+// ServeHTTP writes the current metrics. A server that cannot be scraped is
+// reported as down rather than failing the response, so that the other
+// server's metrics are still collected.
+func (e Exporter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var metrics []metric
+
+	nginx, err := e.scrapeNginx(req.Context())
+	if err != nil {
+		fmt.Fprintf(e.logs, "php-nginx-exporter: failed to scrape Nginx: %s\n", err)
+	}
+	metrics = append(metrics, nginx.metrics(err == nil)...)
+
+	fpm, err := e.scrapeFpm(req.Context())
+	if err != nil {
+		fmt.Fprintf(e.logs, "php-nginx-exporter: failed to scrape FPM: %s\n", err)
+	}
+	metrics = append(metrics, fpm.metrics(err == nil)...)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+func (e Exporter) get(ctx context.Context, path string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+
+	return resp.Body, nil
+}
+
+// nginxStatus is the output of Nginx's stub_status.
+type nginxStatus struct {
+	Active   uint64
+	Accepted uint64
+	Handled  uint64
+	Requests uint64
+	Reading  uint64
+	Writing  uint64
+	Waiting  uint64
+}
+
+func (e Exporter) scrapeNginx(ctx context.Context) (nginxStatus, error) {
+	body, err := e.get(ctx, NginxStatusPath)
+	if err != nil {
+		return nginxStatus{}, err
+	}
+	defer body.Close()
+
+	return parseNginxStatus(body)
+}
+
+// parseNginxStatus parses the output of stub_status, which looks like:
+//
+//	Active connections: 291
+//	server accepts handled requests
+//	 16630948 16630948 31070465
+//	Reading: 6 Writing: 179 Waiting: 106
+func parseNginxStatus(r io.Reader) (nginxStatus, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimSpace(scanner.Text()))
+	}
+	if err := scanner.Err(); err != nil {
+		return nginxStatus{}, err
+	}
+
+	if len(lines) < 4 {
+		return nginxStatus{}, fmt.Errorf("unexpected stub_status output: %q", strings.Join(lines, "\n"))
+	}
+
+	var status nginxStatus
+	_, err := fmt.Sscanf(lines[0], "Active connections: %d", &status.Active)
+	if err == nil {
+		_, err = fmt.Sscanf(lines[2], "%d %d %d", &status.Accepted, &status.Handled, &status.Requests)
+	}
+	if err == nil {
+		_, err = fmt.Sscanf(lines[3], "Reading: %d Writing: %d Waiting: %d", &status.Reading, &status.Writing, &status.Waiting)
+	}
+	if err != nil {
+		return nginxStatus{}, fmt.Errorf("unexpected stub_status output: %q", strings.Join(lines, "\n"))
+	}
+
+	return status, nil
+}
+
+func (s nginxStatus) metrics(up bool) []metric {
+	metrics := []metric{
+		gauge("nginx_up", "Whether the last scrape of Nginx succeeded.", boolValue(up)),
+	}
+	if !up {
+		return metrics
+	}
+
+	return append(metrics,
+		gauge("nginx_connections_active", "Active client connections.", s.Active),
+		counter("nginx_connections_accepted_total", "Accepted client connections.", s.Accepted),
+		counter("nginx_connections_handled_total", "Handled client connections.", s.Handled),
+		counter("nginx_http_requests_total", "Total HTTP requests.", s.Requests),
+		gauge("nginx_connections_reading", "Connections where Nginx is reading the request header.", s.Reading),
+		gauge("nginx_connections_writing", "Connections where Nginx is writing the response.", s.Writing),
+		gauge("nginx_connections_waiting", "Idle client connections.", s.Waiting),
+	)
+}
+
+// fpmStatus is the JSON status page of an FPM pool.
+type fpmStatus struct {
+	Pool               string `json:"pool"`
+	StartSince         uint64 `json:"start since"`
+	AcceptedConn       uint64 `json:"accepted conn"`
+	ListenQueue        uint64 `json:"listen queue"`
+	MaxListenQueue     uint64 `json:"max listen queue"`
+	ListenQueueLen     uint64 `json:"listen queue len"`
+	IdleProcesses      uint64 `json:"idle processes"`
+	ActiveProcesses    uint64 `json:"active processes"`
+	TotalProcesses     uint64 `json:"total processes"`
+	MaxActiveProcesses uint64 `json:"max active processes"`
+	MaxChildrenReached uint64 `json:"max children reached"`
+	SlowRequests       uint64 `json:"slow requests"`
+}
+
+func (e Exporter) scrapeFpm(ctx context.Context) (fpmStatus, error) {
+	body, err := e.get(ctx, e.fpmStatusPath+"?json")
+	if err != nil {
+		return fpmStatus{}, err
+	}
+	defer body.Close()
+
+	var status fpmStatus
+	err = json.NewDecoder(body).Decode(&status)
+	if err != nil {
+		return fpmStatus{}, fmt.Errorf("failed to parse the FPM status: %w", err)
+	}
+
+	return status, nil
+}
+
+func (s fpmStatus) metrics(up bool) []metric {
+	metrics := []metric{
+		gauge("phpfpm_up", "Whether the last scrape of FPM succeeded.", boolValue(up)),
+	}
+	if !up {
+		return metrics
+	}
+
+	metrics = append(metrics,
+		gauge("phpfpm_start_since", "Seconds since FPM started.", s.StartSince),
+		counter("phpfpm_accepted_connections_total", "Requests accepted by the pool.", s.AcceptedConn),
+		gauge("phpfpm_listen_queue", "Requests waiting for a free process.", s.ListenQueue),
+		gauge("phpfpm_max_listen_queue", "Most requests waiting for a free process since FPM started.", s.MaxListenQueue),
+		gauge("phpfpm_listen_queue_length", "Size of the socket queue of pending connections.", s.ListenQueueLen),
+		gauge("phpfpm_idle_processes", "Idle processes.", s.IdleProcesses),
+		gauge("phpfpm_active_processes", "Active processes.", s.ActiveProcesses),
+		gauge("phpfpm_total_processes", "Idle and active processes.", s.TotalProcesses),
+		gauge("phpfpm_max_active_processes", "Most active processes since FPM started.", s.MaxActiveProcesses),
+		counter("phpfpm_max_children_reached_total", "Times the process limit has been reached.", s.MaxChildrenReached),
+		counter("phpfpm_slow_requests_total", "Requests that exceeded request_slowlog_timeout.", s.SlowRequests),
+	)
+	for i := 1; i < len(metrics); i++ {
+		metrics[i].labels = fmt.Sprintf(`pool=%q`, s.Pool)
+	}
+
+	return metrics
+}
+
+// metric is a single sample in the Prometheus text format.
+type metric struct {
+	name   string
+	help   string
+	kind   string
+	labels string
+	value  uint64
+}
+
+func gauge(name, help string, value uint64) metric {
+	return metric{name: name, help: help, kind: "gauge", value: value}
+}
+
+func counter(name, help string, value uint64) metric {
+	return metric{name: name, help: help, kind: "counter", value: value}
+}
+
+func boolValue(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (m metric) write(w io.Writer) {
+	labels := ""
+	if m.labels != "" {
+		labels = "{" + m.labels + "}"
+	}
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s%s %s\n", m.name, m.help, m.name, m.kind, m.name, labels, strconv.FormatUint(m.value, 10))
+}
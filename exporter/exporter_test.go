@@ -0,0 +1,149 @@
+package exporter_test
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paketo-buildpacks/php-nginx/exporter"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testExporter(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		dir        string
+		socket     string
+		listener   net.Listener
+		server     *http.Server
+		logs       *bytes.Buffer
+		nginxBody  string
+		fpmBody    string
+		fpmQueries []string
+
+		scrape func() string
+	)
+
+	it.Before(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "exporter")
+		Expect(err).NotTo(HaveOccurred())
+
+		nginxBody = "Active connections: 3 \nserver accepts handled requests\n 120 118 450 \nReading: 0 Writing: 1 Waiting: 2 \n"
+		fpmBody = `{"pool":"www","process manager":"dynamic","start time":1700000000,"start since":42,"accepted conn":450,"listen queue":1,"max listen queue":4,"listen queue len":511,"idle processes":3,"active processes":1,"total processes":4,"max active processes":5,"max children reached":2,"slow requests":0}`
+		fpmQueries = nil
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/nginx-status", func(w http.ResponseWriter, req *http.Request) {
+			fmt.Fprint(w, nginxBody)
+		})
+		mux.HandleFunc("/status", func(w http.ResponseWriter, req *http.Request) {
+			fpmQueries = append(fpmQueries, req.URL.RawQuery)
+			if fpmBody == "" {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			fmt.Fprint(w, fpmBody)
+		})
+
+		socket = filepath.Join(dir, "status.socket")
+		listener, err = net.Listen("unix", socket)
+		Expect(err).NotTo(HaveOccurred())
+
+		server = &http.Server{Handler: mux}
+		go func() { _ = server.Serve(listener) }()
+
+		logs = bytes.NewBuffer(nil)
+		scrape = func() string {
+			recorder := httptest.NewRecorder()
+			exporter.NewExporter(socket, "/status", logs).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Header().Get("Content-Type")).To(Equal("text/plain; version=0.0.4; charset=utf-8"))
+			return recorder.Body.String()
+		}
+	})
+
+	it.After(func() {
+		Expect(server.Close()).To(Succeed())
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	it("serves the Nginx and FPM statuses in the Prometheus text format", func() {
+		metrics := scrape()
+
+		Expect(metrics).To(ContainSubstring("# HELP nginx_up Whether the last scrape of Nginx succeeded.\n# TYPE nginx_up gauge\nnginx_up 1\n"))
+		Expect(metrics).To(ContainSubstring("# TYPE nginx_connections_active gauge\nnginx_connections_active 3\n"))
+		Expect(metrics).To(ContainSubstring("# TYPE nginx_connections_accepted_total counter\nnginx_connections_accepted_total 120\n"))
+		Expect(metrics).To(ContainSubstring("nginx_connections_handled_total 118\n"))
+		Expect(metrics).To(ContainSubstring("# TYPE nginx_http_requests_total counter\nnginx_http_requests_total 450\n"))
+		Expect(metrics).To(ContainSubstring("nginx_connections_reading 0\n"))
+		Expect(metrics).To(ContainSubstring("nginx_connections_writing 1\n"))
+		Expect(metrics).To(ContainSubstring("nginx_connections_waiting 2\n"))
+
+		Expect(metrics).To(ContainSubstring("# TYPE phpfpm_up gauge\nphpfpm_up 1\n"))
+		Expect(metrics).To(ContainSubstring(`phpfpm_start_since{pool="www"} 42` + "\n"))
+		Expect(metrics).To(ContainSubstring("# TYPE phpfpm_accepted_connections_total counter\n" + `phpfpm_accepted_connections_total{pool="www"} 450` + "\n"))
+		Expect(metrics).To(ContainSubstring(`phpfpm_listen_queue{pool="www"} 1` + "\n"))
+		Expect(metrics).To(ContainSubstring(`phpfpm_max_listen_queue{pool="www"} 4` + "\n"))
+		Expect(metrics).To(ContainSubstring(`phpfpm_listen_queue_length{pool="www"} 511` + "\n"))
+		Expect(metrics).To(ContainSubstring(`phpfpm_idle_processes{pool="www"} 3` + "\n"))
+		Expect(metrics).To(ContainSubstring(`phpfpm_active_processes{pool="www"} 1` + "\n"))
+		Expect(metrics).To(ContainSubstring(`phpfpm_total_processes{pool="www"} 4` + "\n"))
+		Expect(metrics).To(ContainSubstring(`phpfpm_max_active_processes{pool="www"} 5` + "\n"))
+		Expect(metrics).To(ContainSubstring(`phpfpm_max_children_reached_total{pool="www"} 2` + "\n"))
+		Expect(metrics).To(ContainSubstring(`phpfpm_slow_requests_total{pool="www"} 0` + "\n"))
+
+		Expect(fpmQueries).To(Equal([]string{"json"}))
+		Expect(logs.String()).To(BeEmpty())
+	})
+
+	context("when FPM cannot be scraped", func() {
+		it.Before(func() {
+			fpmBody = ""
+		})
+
+		it("reports FPM as down and still serves the Nginx metrics", func() {
+			metrics := scrape()
+
+			Expect(metrics).To(ContainSubstring("nginx_up 1\n"))
+			Expect(metrics).To(ContainSubstring("nginx_http_requests_total 450\n"))
+			Expect(metrics).To(ContainSubstring("phpfpm_up 0\n"))
+			Expect(metrics).NotTo(ContainSubstring("phpfpm_accepted_connections_total"))
+			Expect(logs.String()).To(ContainSubstring("php-nginx-exporter: failed to scrape FPM: GET /status?json: 502 Bad Gateway"))
+		})
+	})
+
+	context("when the Nginx status cannot be parsed", func() {
+		it.Before(func() {
+			nginxBody = "<html>not found</html>"
+		})
+
+		it("reports Nginx as down", func() {
+			metrics := scrape()
+
+			Expect(metrics).To(ContainSubstring("nginx_up 0\n"))
+			Expect(metrics).NotTo(ContainSubstring("nginx_connections_active"))
+			Expect(metrics).To(ContainSubstring("phpfpm_up 1\n"))
+			Expect(logs.String()).To(ContainSubstring("php-nginx-exporter: failed to scrape Nginx: unexpected stub_status output"))
+		})
+	})
+
+	context("when the status socket does not exist", func() {
+		it("reports both servers as down", func() {
+			recorder := httptest.NewRecorder()
+			exporter.NewExporter(filepath.Join(dir, "missing.socket"), "/status", logs).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+			Expect(recorder.Body.String()).To(ContainSubstring("nginx_up 0\n"))
+			Expect(recorder.Body.String()).To(ContainSubstring("phpfpm_up 0\n"))
+			Expect(logs.String()).To(ContainSubstring("no such file or directory"))
+		})
+	})
+}
@@ -0,0 +1,14 @@
+package exporter_test
+
+import (
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitExporter(t *testing.T) {
+	suite := spec.New("exporter", spec.Report(report.Terminal{}), spec.Parallel())
+	suite("Exporter", testExporter)
+	suite.Run(t)
+}
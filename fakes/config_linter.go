@@ -0,0 +1,28 @@
+package fakes
+
+import "sync"
+
+type ConfigLinter struct {
+	LintCall struct {
+		mutex     sync.Mutex
+		CallCount int
+		Receives  struct {
+			Path string
+		}
+		Returns struct {
+			Error error
+		}
+		Stub func(string) error
+	}
+}
+
+func (f *ConfigLinter) Lint(param1 string) error {
+	f.LintCall.mutex.Lock()
+	defer f.LintCall.mutex.Unlock()
+	f.LintCall.CallCount++
+	f.LintCall.Receives.Path = param1
+	if f.LintCall.Stub != nil {
+		return f.LintCall.Stub(param1)
+	}
+	return f.LintCall.Returns.Error
+}
@@ -0,0 +1,451 @@
+package phpnginx
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paketo-buildpacks/php-nginx/launcher"
+)
+
+// DefaultFpmSocket is the unix socket FPM listens on when $BP_PHP_FPM_LISTEN
+// is not set.
+const DefaultFpmSocket = "/tmp/php-fpm.socket"
+
+// defaultFpmPoolMaxChildren is the maximum number of children of an
+// additional FPM pool when $BP_PHP_FPM_POOL_<NAME>_MAX_CHILDREN is not set.
+const defaultFpmPoolMaxChildren = 5
+
+// defaultKeepaliveTimeout is how long Nginx keeps idle client connections
+// open when $BP_PHP_NGINX_KEEPALIVE_TIMEOUT is not set.
+const defaultKeepaliveTimeout = 65 * time.Second
+
+// defaultFpmMaxChildren is FPM's own default for pm.max_children, used when
+// neither the memory limit nor $BPL_PHP_FPM_MAX_CHILDREN give one.
+const defaultFpmMaxChildren = 5
+
+const (
+	// defaultFpmMemoryPerChild is the memory estimate of one FPM child when
+	// $BPL_PHP_FPM_MEMORY_PER_CHILD is not set.
+	defaultFpmMemoryPerChild = 64 << 20
+
+	// fpmReservedMemory is kept out of the memory limit for the FPM master,
+	// Nginx and the launcher when sizing the www pool.
+	fpmReservedMemory = 64 << 20
+)
+
+var fpmPoolName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// FpmAddress is the address FPM listens on, either a unix socket or a TCP
+// host and port.
+type FpmAddress struct {
+	Network string
+	Address string
+}
+
+// String returns the address in the form used by FPM's listen directive.
+func (a FpmAddress) String() string {
+	return a.Address
+}
+
+// Upstream returns the address in the form used by Nginx's upstream server
+// directive.
+func (a FpmAddress) Upstream() string {
+	if a.Network == "unix" {
+		return "unix:" + a.Address
+	}
+	return a.Address
+}
+
+// Description returns a human-readable description of the address for
+// logging.
+func (a FpmAddress) Description() string {
+	if a.Network == "unix" {
+		return fmt.Sprintf("FPM socket: %s", a.Address)
+	}
+	return fmt.Sprintf("FPM TCP address: %s", a.Address)
+}
+
+// ParseFpmAddress parses an FPM listen address given as an absolute unix
+// socket path (optionally prefixed with "unix:"), a "host:port" pair or a
+// bare port, which listens on the loopback interface.
+func ParseFpmAddress(value string) (FpmAddress, error) {
+	value = strings.TrimSpace(value)
+
+	if path, ok := strings.CutPrefix(value, "unix:"); ok || strings.HasPrefix(value, "/") {
+		if !ok {
+			path = value
+		}
+		if !filepath.IsAbs(path) {
+			return FpmAddress{}, fmt.Errorf("unix socket path %q must be absolute", path)
+		}
+		return FpmAddress{Network: "unix", Address: filepath.Clean(path)}, nil
+	}
+
+	host, port := "127.0.0.1", value
+	if strings.Contains(value, ":") {
+		var err error
+		host, port, err = net.SplitHostPort(value)
+		if err != nil {
+			return FpmAddress{}, fmt.Errorf("%q is not a unix socket path or host:port: %w", value, err)
+		}
+		if host == "" {
+			return FpmAddress{}, fmt.Errorf("%q is missing a host", value)
+		}
+	}
+
+	portNumber, err := strconv.Atoi(port)
+	if err != nil || portNumber < 1 || portNumber > 65535 {
+		return FpmAddress{}, fmt.Errorf("%q is not a unix socket path or host:port: invalid port %q", value, port)
+	}
+
+	return FpmAddress{Network: "tcp", Address: net.JoinHostPort(host, port)}, nil
+}
+
+// LoadFpmAddress returns the address FPM listens on, as configured through
+// $BP_PHP_FPM_LISTEN. When it is not set, FPM listens on DefaultFpmSocket,
+// or on all interfaces at the port of $BP_PHP_FPM_REMOTE_ADDRESS so that a
+// separate Nginx container can reach it.
+func LoadFpmAddress() (FpmAddress, error) {
+	value, ok := os.LookupEnv("BP_PHP_FPM_LISTEN")
+	if !ok || strings.TrimSpace(value) == "" {
+		remote, ok, err := loadFpmRemoteAddress()
+		if err != nil {
+			return FpmAddress{}, err
+		}
+		if ok && remote.Network == "tcp" {
+			_, port, _ := net.SplitHostPort(remote.Address)
+			return FpmAddress{Network: "tcp", Address: net.JoinHostPort("0.0.0.0", port)}, nil
+		}
+		if ok {
+			return remote, nil
+		}
+
+		return FpmAddress{Network: "unix", Address: DefaultFpmSocket}, nil
+	}
+
+	address, err := ParseFpmAddress(value)
+	if err != nil {
+		return FpmAddress{}, fmt.Errorf("failed to parse $BP_PHP_FPM_LISTEN: %w", err)
+	}
+
+	return address, nil
+}
+
+// LoadFpmUpstream returns the address Nginx uses to reach FPM. This is
+// $BP_PHP_FPM_REMOTE_ADDRESS when FPM runs in a separate container, and the
+// address FPM listens on otherwise. The returned boolean reports whether FPM
+// is remote.
+func LoadFpmUpstream() (FpmAddress, bool, error) {
+	remote, ok, err := loadFpmRemoteAddress()
+	if err != nil || ok {
+		return remote, ok, err
+	}
+
+	address, err := LoadFpmAddress()
+	return address, false, err
+}
+
+func loadFpmRemoteAddress() (FpmAddress, bool, error) {
+	value, ok := os.LookupEnv("BP_PHP_FPM_REMOTE_ADDRESS")
+	if !ok || strings.TrimSpace(value) == "" {
+		return FpmAddress{}, false, nil
+	}
+
+	address, err := ParseFpmAddress(value)
+	if err != nil {
+		return FpmAddress{}, false, fmt.Errorf("failed to parse $BP_PHP_FPM_REMOTE_ADDRESS: %w", err)
+	}
+
+	return address, true, nil
+}
+
+// FpmPool is an additional FPM pool that serves the requests under a path
+// prefix, next to the default "www" pool.
+type FpmPool struct {
+	Name           string
+	PathPrefix     string
+	Listen         FpmAddress
+	MaxChildren    int
+	RequestTimeout time.Duration
+	MaxBodySize    string
+}
+
+// Upstream returns the name of the Nginx upstream for the pool.
+func (p FpmPool) Upstream() string {
+	return "php_fpm_" + p.Name
+}
+
+// Timeout returns the request timeout of the pool in seconds, in the form
+// used by both Nginx and FPM, or an empty string when there is none.
+func (p FpmPool) Timeout() string {
+	return formatTimeout(p.RequestTimeout)
+}
+
+// LoadRequestTimeout returns the timeout of $BP_PHP_REQUEST_TIMEOUT, which
+// applies to both Nginx and FPM, or 0 when it is not set.
+func LoadRequestTimeout() (time.Duration, error) {
+	timeout, _, err := lookupTimeout("BP_PHP_REQUEST_TIMEOUT")
+	return timeout, err
+}
+
+// LoadFpmPools returns the additional FPM pools named in $BP_PHP_FPM_POOLS.
+// Each pool is configured through $BP_PHP_FPM_POOL_<NAME>_PATH (required),
+// $BP_PHP_FPM_POOL_<NAME>_LISTEN, $BP_PHP_FPM_POOL_<NAME>_MAX_CHILDREN and
+// $BP_PHP_FPM_POOL_<NAME>_REQUEST_TIMEOUT, which defaults to
+// $BP_PHP_REQUEST_TIMEOUT.
+func LoadFpmPools() ([]FpmPool, error) {
+	requestTimeout, err := LoadRequestTimeout()
+	if err != nil {
+		return nil, err
+	}
+
+	var pools []FpmPool
+	seen := map[string]bool{}
+	prefixes := map[string]bool{}
+	for _, name := range splitList(os.Getenv("BP_PHP_FPM_POOLS")) {
+		if !fpmPoolName.MatchString(name) {
+			return nil, fmt.Errorf("failed to parse $BP_PHP_FPM_POOLS: pool name %q must be lowercase letters, digits and underscores", name)
+		}
+		if name == "www" || seen[name] {
+			return nil, fmt.Errorf("failed to parse $BP_PHP_FPM_POOLS: pool %q is defined more than once", name)
+		}
+		seen[name] = true
+
+		pool, err := loadFpmPool(name, requestTimeout)
+		if err != nil {
+			return nil, err
+		}
+
+		// Nginx refuses to start with two locations for the same prefix.
+		if prefixes[pool.PathPrefix] {
+			return nil, fmt.Errorf("failed to parse $BP_PHP_FPM_POOL_%s_PATH: %q is already the path of another pool", strings.ToUpper(name), pool.PathPrefix)
+		}
+		prefixes[pool.PathPrefix] = true
+
+		pools = append(pools, pool)
+	}
+
+	return pools, nil
+}
+
+func loadFpmPool(name string, requestTimeout time.Duration) (FpmPool, error) {
+	prefix := fmt.Sprintf("BP_PHP_FPM_POOL_%s_", strings.ToUpper(name))
+	pool := FpmPool{
+		Name:           name,
+		Listen:         FpmAddress{Network: "unix", Address: fmt.Sprintf("/tmp/php-fpm-%s.socket", name)},
+		MaxChildren:    defaultFpmPoolMaxChildren,
+		RequestTimeout: requestTimeout,
+	}
+
+	path := os.Getenv(prefix + "PATH")
+	if !strings.HasPrefix(path, "/") {
+		return FpmPool{}, fmt.Errorf("failed to parse $%sPATH: %q must be a path starting with \"/\"", prefix, path)
+	}
+	pool.PathPrefix = strings.TrimSuffix(path, "/") + "/"
+	if pool.PathPrefix == "/" {
+		return FpmPool{}, fmt.Errorf("failed to parse $%sPATH: %q would serve the whole site from the pool instead of the www pool", prefix, path)
+	}
+
+	if value, ok := os.LookupEnv(prefix + "LISTEN"); ok && strings.TrimSpace(value) != "" {
+		address, err := ParseFpmAddress(value)
+		if err != nil {
+			return FpmPool{}, fmt.Errorf("failed to parse $%sLISTEN: %w", prefix, err)
+		}
+		pool.Listen = address
+	}
+
+	if value, ok := os.LookupEnv(prefix + "MAX_CHILDREN"); ok {
+		maxChildren, err := strconv.Atoi(value)
+		if err != nil || maxChildren < 1 {
+			return FpmPool{}, fmt.Errorf("failed to parse $%sMAX_CHILDREN: %q is not a positive integer", prefix, value)
+		}
+		pool.MaxChildren = maxChildren
+	}
+
+	timeout, ok, err := lookupTimeout(prefix + "REQUEST_TIMEOUT")
+	if err != nil {
+		return FpmPool{}, err
+	}
+	if ok {
+		pool.RequestTimeout = timeout
+	}
+
+	return pool, nil
+}
+
+const (
+	defaultFpmStatusPath = "/fpm-status"
+	defaultFpmPingPath   = "/fpm-ping"
+)
+
+// FpmStatus exposes the status page and ping endpoint of the www pool
+// through Nginx. A zero value disables them.
+type FpmStatus struct {
+	StatusPath   string
+	PingPath     string
+	PingResponse string
+
+	// Allow lists the addresses and CIDR ranges of the connections allowed to
+	// reach the endpoints.
+	Allow []string
+
+	// Port, when set, serves the endpoints on a server of their own instead
+	// of the application's.
+	Port int
+}
+
+// LoadFpmStatus returns the status and ping endpoints configured through
+// $BP_PHP_FPM_ENABLE_STATUS, $BP_PHP_FPM_STATUS_PATH, $BP_PHP_FPM_PING_PATH,
+// $BP_PHP_FPM_PING_RESPONSE, $BP_PHP_FPM_STATUS_ALLOW and
+// $BP_PHP_FPM_STATUS_PORT.
+func LoadFpmStatus() (FpmStatus, error) {
+	enabled := false
+	if value, ok := os.LookupEnv("BP_PHP_FPM_ENABLE_STATUS"); ok {
+		var err error
+		enabled, err = strconv.ParseBool(value)
+		if err != nil {
+			return FpmStatus{}, fmt.Errorf("failed to parse $BP_PHP_FPM_ENABLE_STATUS into boolean: %w", err)
+		}
+	}
+	if !enabled {
+		return FpmStatus{}, nil
+	}
+
+	status := FpmStatus{
+		StatusPath:   defaultFpmStatusPath,
+		PingPath:     defaultFpmPingPath,
+		PingResponse: "pong",
+		Allow:        []string{"127.0.0.1", "::1"},
+	}
+
+	for _, setting := range []struct {
+		name   string
+		target *string
+	}{
+		{"BP_PHP_FPM_STATUS_PATH", &status.StatusPath},
+		{"BP_PHP_FPM_PING_PATH", &status.PingPath},
+	} {
+		value, ok := os.LookupEnv(setting.name)
+		if !ok {
+			continue
+		}
+		if !strings.HasPrefix(value, "/") || strings.ContainsAny(value, " \t;{}") {
+			return FpmStatus{}, fmt.Errorf("failed to parse $%s: %q must be a path starting with \"/\"", setting.name, value)
+		}
+		*setting.target = value
+	}
+	if status.StatusPath == status.PingPath {
+		return FpmStatus{}, fmt.Errorf("failed to parse $BP_PHP_FPM_PING_PATH: %q is already the status path", status.PingPath)
+	}
+
+	if value, ok := os.LookupEnv("BP_PHP_FPM_PING_RESPONSE"); ok {
+		if strings.TrimSpace(value) == "" || strings.ContainsAny(value, "\n\"") {
+			return FpmStatus{}, fmt.Errorf("failed to parse $BP_PHP_FPM_PING_RESPONSE: %q is not a single line of text", value)
+		}
+		status.PingResponse = value
+	}
+
+	if value, ok := os.LookupEnv("BP_PHP_FPM_STATUS_ALLOW"); ok {
+		status.Allow = splitList(value)
+		if len(status.Allow) == 0 {
+			return FpmStatus{}, fmt.Errorf("failed to parse $BP_PHP_FPM_STATUS_ALLOW: at least one address must be given")
+		}
+		for _, entry := range status.Allow {
+			if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+				return FpmStatus{}, fmt.Errorf("failed to parse $BP_PHP_FPM_STATUS_ALLOW: %q is not an IP address or a CIDR range", entry)
+			}
+		}
+	}
+
+	if value, ok := os.LookupEnv("BP_PHP_FPM_STATUS_PORT"); ok {
+		port, err := strconv.Atoi(value)
+		if err != nil || port < 1 || port > 65535 {
+			return FpmStatus{}, fmt.Errorf("failed to parse $BP_PHP_FPM_STATUS_PORT: %q is not a port number", value)
+		}
+		status.Port = port
+	}
+
+	return status, nil
+}
+
+// FpmProcessManager is the process manager configuration of the www pool. A
+// zero value leaves the settings of the base FPM configuration in place.
+type FpmProcessManager struct {
+	Mode            string
+	MaxChildren     int
+	StartServers    int
+	MinSpareServers int
+	MaxSpareServers int
+}
+
+// newFpmProcessManager returns a dynamic process manager for maxChildren
+// children that keeps between a quarter and half of them idle, starting
+// halfway between the two like FPM does.
+func newFpmProcessManager(maxChildren int) FpmProcessManager {
+	minSpare := maxChildren / 4
+	if minSpare < 1 {
+		minSpare = 1
+	}
+
+	maxSpare := maxChildren / 2
+	if maxSpare < minSpare {
+		maxSpare = minSpare
+	}
+
+	return FpmProcessManager{
+		Mode:            "dynamic",
+		MaxChildren:     maxChildren,
+		StartServers:    minSpare + (maxSpare-minSpare)/2,
+		MinSpareServers: minSpare,
+		MaxSpareServers: maxSpare,
+	}
+}
+
+// validate checks the constraints FPM puts on the spare servers of a dynamic
+// process manager.
+func (m FpmProcessManager) validate() error {
+	if m.Mode != "dynamic" {
+		return nil
+	}
+
+	if m.MinSpareServers > m.StartServers || m.StartServers > m.MaxSpareServers {
+		return fmt.Errorf("pm.start_servers (%d) must be between pm.min_spare_servers (%d) and pm.max_spare_servers (%d)", m.StartServers, m.MinSpareServers, m.MaxSpareServers)
+	}
+
+	if m.MaxSpareServers > m.MaxChildren {
+		return fmt.Errorf("pm.max_spare_servers (%d) must not be greater than pm.max_children (%d)", m.MaxSpareServers, m.MaxChildren)
+	}
+
+	return nil
+}
+
+// lookupTimeout parses the timeout in the environment variable name, if it
+// is set.
+func lookupTimeout(name string) (time.Duration, bool, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return 0, false, nil
+	}
+
+	timeout, err := launcher.ParseTimeout(value)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to parse $%s: %w", name, err)
+	}
+
+	return timeout, true, nil
+}
+
+// formatTimeout formats a timeout in seconds, in the form used by both Nginx
+// and FPM, or returns an empty string when there is none.
+func formatTimeout(timeout time.Duration) string {
+	if timeout == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%ds", int(timeout.Seconds()))
+}
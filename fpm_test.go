@@ -0,0 +1,204 @@
+package phpnginx_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	phpnginx "github.com/paketo-buildpacks/php-nginx"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testFpm(t *testing.T, context spec.G, it spec.S) {
+	var Expect = NewWithT(t).Expect
+
+	context("ParseFpmAddress", func() {
+		it("parses unix socket paths", func() {
+			address, err := phpnginx.ParseFpmAddress("/tmp/some/../fpm.socket")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(address).To(Equal(phpnginx.FpmAddress{Network: "unix", Address: "/tmp/fpm.socket"}))
+			Expect(address.String()).To(Equal("/tmp/fpm.socket"))
+			Expect(address.Upstream()).To(Equal("unix:/tmp/fpm.socket"))
+			Expect(address.Description()).To(Equal("FPM socket: /tmp/fpm.socket"))
+
+			address, err = phpnginx.ParseFpmAddress("unix:/tmp/fpm.socket")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(address).To(Equal(phpnginx.FpmAddress{Network: "unix", Address: "/tmp/fpm.socket"}))
+		})
+
+		it("parses host:port addresses", func() {
+			address, err := phpnginx.ParseFpmAddress("fpm.internal:9000")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(address).To(Equal(phpnginx.FpmAddress{Network: "tcp", Address: "fpm.internal:9000"}))
+			Expect(address.String()).To(Equal("fpm.internal:9000"))
+			Expect(address.Upstream()).To(Equal("fpm.internal:9000"))
+			Expect(address.Description()).To(Equal("FPM TCP address: fpm.internal:9000"))
+
+			address, err = phpnginx.ParseFpmAddress("[::1]:9000")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(address).To(Equal(phpnginx.FpmAddress{Network: "tcp", Address: "[::1]:9000"}))
+		})
+
+		it("parses bare ports as loopback addresses", func() {
+			address, err := phpnginx.ParseFpmAddress("9000")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(address).To(Equal(phpnginx.FpmAddress{Network: "tcp", Address: "127.0.0.1:9000"}))
+		})
+
+		context("failure cases", func() {
+			it("rejects relative socket paths", func() {
+				_, err := phpnginx.ParseFpmAddress("unix:tmp/fpm.socket")
+				Expect(err).To(MatchError(`unix socket path "tmp/fpm.socket" must be absolute`))
+			})
+
+			it("rejects addresses without a host", func() {
+				_, err := phpnginx.ParseFpmAddress(":9000")
+				Expect(err).To(MatchError(`":9000" is missing a host`))
+			})
+
+			it("rejects invalid ports", func() {
+				_, err := phpnginx.ParseFpmAddress("localhost:99999")
+				Expect(err).To(MatchError(`"localhost:99999" is not a unix socket path or host:port: invalid port "99999"`))
+
+				_, err = phpnginx.ParseFpmAddress("some-socket")
+				Expect(err).To(MatchError(ContainSubstring(`invalid port "some-socket"`)))
+			})
+		})
+	})
+	context("LoadFpmPools", func() {
+		it.After(func() {
+			for _, name := range []string{
+				"BP_PHP_FPM_POOLS",
+				"BP_PHP_FPM_POOL_ADMIN_PATH",
+				"BP_PHP_FPM_POOL_ADMIN_LISTEN",
+				"BP_PHP_FPM_POOL_ADMIN_MAX_CHILDREN",
+				"BP_PHP_FPM_POOL_ADMIN_REQUEST_TIMEOUT",
+				"BP_PHP_FPM_POOL_API_PATH",
+			} {
+				Expect(os.Unsetenv(name)).To(Succeed())
+			}
+		})
+
+		it("returns no pools when none are configured", func() {
+			pools, err := phpnginx.LoadFpmPools()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pools).To(BeEmpty())
+		})
+
+		it("loads each configured pool", func() {
+			Expect(os.Setenv("BP_PHP_FPM_POOLS", "admin,api")).To(Succeed())
+			Expect(os.Setenv("BP_PHP_FPM_POOL_ADMIN_PATH", "/admin")).To(Succeed())
+			Expect(os.Setenv("BP_PHP_FPM_POOL_ADMIN_LISTEN", "9001")).To(Succeed())
+			Expect(os.Setenv("BP_PHP_FPM_POOL_ADMIN_MAX_CHILDREN", "2")).To(Succeed())
+			Expect(os.Setenv("BP_PHP_FPM_POOL_ADMIN_REQUEST_TIMEOUT", "5m")).To(Succeed())
+			Expect(os.Setenv("BP_PHP_FPM_POOL_API_PATH", "/api/")).To(Succeed())
+
+			pools, err := phpnginx.LoadFpmPools()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pools).To(Equal([]phpnginx.FpmPool{
+				{
+					Name:           "admin",
+					PathPrefix:     "/admin/",
+					Listen:         phpnginx.FpmAddress{Network: "tcp", Address: "127.0.0.1:9001"},
+					MaxChildren:    2,
+					RequestTimeout: 5 * time.Minute,
+				},
+				{
+					Name:        "api",
+					PathPrefix:  "/api/",
+					Listen:      phpnginx.FpmAddress{Network: "unix", Address: "/tmp/php-fpm-api.socket"},
+					MaxChildren: 5,
+				},
+			}))
+			Expect(pools[0].Upstream()).To(Equal("php_fpm_admin"))
+			Expect(pools[0].Timeout()).To(Equal("300s"))
+			Expect(pools[1].Timeout()).To(BeEmpty())
+		})
+
+		it("accepts request timeouts in seconds", func() {
+			Expect(os.Setenv("BP_PHP_FPM_POOLS", "admin")).To(Succeed())
+			Expect(os.Setenv("BP_PHP_FPM_POOL_ADMIN_PATH", "/admin")).To(Succeed())
+			Expect(os.Setenv("BP_PHP_FPM_POOL_ADMIN_REQUEST_TIMEOUT", "90")).To(Succeed())
+
+			pools, err := phpnginx.LoadFpmPools()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pools[0].Timeout()).To(Equal("90s"))
+		})
+
+		context("failure cases", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_FPM_POOLS", "admin")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_FPM_POOL_ADMIN_PATH", "/admin")).To(Succeed())
+			})
+
+			it("rejects invalid pool names", func() {
+				Expect(os.Setenv("BP_PHP_FPM_POOLS", "Admin-Pool")).To(Succeed())
+
+				_, err := phpnginx.LoadFpmPools()
+				Expect(err).To(MatchError(`failed to parse $BP_PHP_FPM_POOLS: pool name "Admin-Pool" must be lowercase letters, digits and underscores`))
+			})
+
+			it("rejects duplicate pools and the default pool", func() {
+				Expect(os.Setenv("BP_PHP_FPM_POOLS", "admin admin")).To(Succeed())
+
+				_, err := phpnginx.LoadFpmPools()
+				Expect(err).To(MatchError(`failed to parse $BP_PHP_FPM_POOLS: pool "admin" is defined more than once`))
+
+				Expect(os.Setenv("BP_PHP_FPM_POOLS", "www")).To(Succeed())
+
+				_, err = phpnginx.LoadFpmPools()
+				Expect(err).To(MatchError(`failed to parse $BP_PHP_FPM_POOLS: pool "www" is defined more than once`))
+			})
+
+			it("requires a path prefix", func() {
+				Expect(os.Unsetenv("BP_PHP_FPM_POOL_ADMIN_PATH")).To(Succeed())
+
+				_, err := phpnginx.LoadFpmPools()
+				Expect(err).To(MatchError(`failed to parse $BP_PHP_FPM_POOL_ADMIN_PATH: "" must be a path starting with "/"`))
+			})
+
+			it("rejects the root path", func() {
+				Expect(os.Setenv("BP_PHP_FPM_POOL_ADMIN_PATH", "/")).To(Succeed())
+
+				_, err := phpnginx.LoadFpmPools()
+				Expect(err).To(MatchError(`failed to parse $BP_PHP_FPM_POOL_ADMIN_PATH: "/" would serve the whole site from the pool instead of the www pool`))
+			})
+
+			it("rejects a path that is already the path of another pool", func() {
+				Expect(os.Setenv("BP_PHP_FPM_POOLS", "admin,api")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_FPM_POOL_API_PATH", "/admin/")).To(Succeed())
+
+				_, err := phpnginx.LoadFpmPools()
+				Expect(err).To(MatchError(`failed to parse $BP_PHP_FPM_POOL_API_PATH: "/admin/" is already the path of another pool`))
+			})
+
+			it("rejects invalid listen addresses", func() {
+				Expect(os.Setenv("BP_PHP_FPM_POOL_ADMIN_LISTEN", "unix:admin.socket")).To(Succeed())
+
+				_, err := phpnginx.LoadFpmPools()
+				Expect(err).To(MatchError(`failed to parse $BP_PHP_FPM_POOL_ADMIN_LISTEN: unix socket path "admin.socket" must be absolute`))
+			})
+
+			it("rejects invalid max children", func() {
+				Expect(os.Setenv("BP_PHP_FPM_POOL_ADMIN_MAX_CHILDREN", "0")).To(Succeed())
+
+				_, err := phpnginx.LoadFpmPools()
+				Expect(err).To(MatchError(`failed to parse $BP_PHP_FPM_POOL_ADMIN_MAX_CHILDREN: "0" is not a positive integer`))
+			})
+
+			it("rejects invalid request timeouts", func() {
+				Expect(os.Setenv("BP_PHP_FPM_POOL_ADMIN_REQUEST_TIMEOUT", "soon")).To(Succeed())
+
+				_, err := phpnginx.LoadFpmPools()
+				Expect(err).To(MatchError(`failed to parse $BP_PHP_FPM_POOL_ADMIN_REQUEST_TIMEOUT: "soon" is not a number of seconds or a duration`))
+
+				Expect(os.Setenv("BP_PHP_FPM_POOL_ADMIN_REQUEST_TIMEOUT", "0")).To(Succeed())
+
+				_, err = phpnginx.LoadFpmPools()
+				Expect(err).To(MatchError(`failed to parse $BP_PHP_FPM_POOL_ADMIN_REQUEST_TIMEOUT: "0" must be at least one second`))
+			})
+		})
+	})
+}
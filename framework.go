@@ -0,0 +1,87 @@
+package phpnginx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Framework describes a PHP framework detected in the application source
+// along with the web directory and routing that it expects.
+type Framework struct {
+	Name            string
+	WebDirectory    string
+	FrontController string
+}
+
+type composerManifest struct {
+	Require map[string]string `json:"require"`
+	Extra   struct {
+		WordpressInstallDir string `json:"wordpress-install-dir"`
+	} `json:"extra"`
+}
+
+// DetectFramework inspects the application's composer.json and well-known
+// framework files to determine which framework the application is built on.
+// It returns a zero Framework when none can be identified.
+func DetectFramework(workingDir string) (Framework, error) {
+	composerPath := filepath.Join(workingDir, "composer.json")
+	if path, ok := os.LookupEnv("COMPOSER"); ok {
+		composerPath = path
+		if !filepath.IsAbs(path) {
+			composerPath = filepath.Join(workingDir, path)
+		}
+	}
+
+	var manifest composerManifest
+	content, err := os.ReadFile(composerPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Framework{}, fmt.Errorf("failed to read %s: %w", composerPath, err)
+	}
+	if err == nil {
+		err = json.Unmarshal(content, &manifest)
+		if err != nil {
+			return Framework{}, fmt.Errorf("failed to parse %s: %w", composerPath, err)
+		}
+	}
+
+	requires := func(packages ...string) bool {
+		for _, p := range packages {
+			if _, ok := manifest.Require[p]; ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	exists := func(path string) bool {
+		_, err := os.Stat(filepath.Join(workingDir, path))
+		return err == nil
+	}
+
+	switch {
+	case requires("laravel/framework") || exists("artisan"):
+		return Framework{Name: "laravel", WebDirectory: "public", FrontController: "index.php"}, nil
+
+	case requires("drupal/core", "drupal/core-recommended"):
+		return Framework{Name: "drupal", WebDirectory: "web", FrontController: "index.php"}, nil
+
+	case requires("johnpbloch/wordpress", "johnpbloch/wordpress-core"):
+		webDir := "wordpress"
+		if manifest.Extra.WordpressInstallDir != "" {
+			webDir = filepath.Clean(manifest.Extra.WordpressInstallDir)
+		}
+		return Framework{Name: "wordpress", WebDirectory: webDir, FrontController: "index.php"}, nil
+
+	case requires("symfony/framework-bundle") || exists(filepath.Join("bin", "console")):
+		// Symfony versions before 4 served the application from web/app.php
+		if !exists("public") && exists(filepath.Join("web", "app.php")) {
+			return Framework{Name: "symfony", WebDirectory: "web", FrontController: "app.php"}, nil
+		}
+		return Framework{Name: "symfony", WebDirectory: "public", FrontController: "index.php"}, nil
+	}
+
+	return Framework{}, nil
+}
@@ -0,0 +1,221 @@
+package phpnginx_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	phpnginx "github.com/paketo-buildpacks/php-nginx"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testFramework(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = os.MkdirTemp("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	context("when there are no framework markers", func() {
+		it("returns an empty framework", func() {
+			framework, err := phpnginx.DetectFramework(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(framework).To(Equal(phpnginx.Framework{}))
+		})
+	})
+
+	context("when composer.json requires laravel/framework", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "composer.json"), []byte(`{"require": {"laravel/framework": "^11.0"}}`), 0600)).To(Succeed())
+		})
+
+		it("detects laravel", func() {
+			framework, err := phpnginx.DetectFramework(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(framework).To(Equal(phpnginx.Framework{
+				Name:            "laravel",
+				WebDirectory:    "public",
+				FrontController: "index.php",
+			}))
+		})
+	})
+
+	context("when there is an artisan file", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "artisan"), nil, 0600)).To(Succeed())
+		})
+
+		it("detects laravel", func() {
+			framework, err := phpnginx.DetectFramework(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(framework.Name).To(Equal("laravel"))
+		})
+	})
+
+	context("when composer.json requires drupal/core", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "composer.json"), []byte(`{"require": {"drupal/core": "^10.0", "symfony/http-kernel": "^6.0"}}`), 0600)).To(Succeed())
+		})
+
+		it("detects drupal", func() {
+			framework, err := phpnginx.DetectFramework(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(framework).To(Equal(phpnginx.Framework{
+				Name:            "drupal",
+				WebDirectory:    "web",
+				FrontController: "index.php",
+			}))
+		})
+	})
+
+	context("when composer.json requires johnpbloch/wordpress", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "composer.json"), []byte(`{"require": {"johnpbloch/wordpress": "^6.0"}}`), 0600)).To(Succeed())
+		})
+
+		it("detects wordpress", func() {
+			framework, err := phpnginx.DetectFramework(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(framework).To(Equal(phpnginx.Framework{
+				Name:            "wordpress",
+				WebDirectory:    "wordpress",
+				FrontController: "index.php",
+			}))
+		})
+
+		context("when the install directory is customized", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "composer.json"), []byte(`{"require": {"johnpbloch/wordpress": "^6.0"}, "extra": {"wordpress-install-dir": "wp/"}}`), 0600)).To(Succeed())
+			})
+
+			it("uses the install directory as the web directory", func() {
+				framework, err := phpnginx.DetectFramework(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(framework.WebDirectory).To(Equal("wp"))
+			})
+		})
+	})
+
+	context("when composer.json requires symfony/framework-bundle", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "composer.json"), []byte(`{"require": {"symfony/framework-bundle": "^7.0"}}`), 0600)).To(Succeed())
+		})
+
+		it("detects symfony", func() {
+			framework, err := phpnginx.DetectFramework(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(framework).To(Equal(phpnginx.Framework{
+				Name:            "symfony",
+				WebDirectory:    "public",
+				FrontController: "index.php",
+			}))
+		})
+
+		context("when the app uses the legacy web/app.php layout", func() {
+			it.Before(func() {
+				Expect(os.MkdirAll(filepath.Join(workingDir, "web"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "web", "app.php"), nil, 0600)).To(Succeed())
+			})
+
+			it("uses the web directory and app.php", func() {
+				framework, err := phpnginx.DetectFramework(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(framework).To(Equal(phpnginx.Framework{
+					Name:            "symfony",
+					WebDirectory:    "web",
+					FrontController: "app.php",
+				}))
+			})
+		})
+	})
+
+	context("when there is a bin/console file", func() {
+		it.Before(func() {
+			Expect(os.MkdirAll(filepath.Join(workingDir, "bin"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, "bin", "console"), nil, 0600)).To(Succeed())
+		})
+
+		it("detects symfony", func() {
+			framework, err := phpnginx.DetectFramework(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(framework.Name).To(Equal("symfony"))
+		})
+	})
+
+	context("when $COMPOSER points to a different manifest", func() {
+		it.Before(func() {
+			Expect(os.Setenv("COMPOSER", "some-composer.json")).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, "some-composer.json"), []byte(`{"require": {"laravel/framework": "^11.0"}}`), 0600)).To(Succeed())
+		})
+
+		it.After(func() {
+			Expect(os.Unsetenv("COMPOSER")).To(Succeed())
+		})
+
+		it("reads that manifest", func() {
+			framework, err := phpnginx.DetectFramework(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(framework.Name).To(Equal("laravel"))
+		})
+	})
+
+	context("when $COMPOSER is an absolute path", func() {
+		var composerDir string
+
+		it.Before(func() {
+			var err error
+			composerDir, err = os.MkdirTemp("", "composer-dir")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(os.WriteFile(filepath.Join(composerDir, "composer.json"), []byte(`{"require": {"drupal/core": "^10.0"}}`), 0600)).To(Succeed())
+			Expect(os.Setenv("COMPOSER", filepath.Join(composerDir, "composer.json"))).To(Succeed())
+		})
+
+		it.After(func() {
+			Expect(os.Unsetenv("COMPOSER")).To(Succeed())
+			Expect(os.RemoveAll(composerDir)).To(Succeed())
+		})
+
+		it("reads that manifest rather than one in the working directory", func() {
+			framework, err := phpnginx.DetectFramework(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(framework.Name).To(Equal("drupal"))
+		})
+	})
+
+	context("failure cases", func() {
+		context("when composer.json cannot be parsed", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "composer.json"), []byte(`%%%`), 0600)).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := phpnginx.DetectFramework(workingDir)
+				Expect(err).To(MatchError(ContainSubstring("failed to parse")))
+			})
+		})
+
+		context("when composer.json cannot be read", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "composer.json"), nil, 0000)).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := phpnginx.DetectFramework(workingDir)
+				Expect(err).To(MatchError(ContainSubstring("failed to read")))
+			})
+		})
+	})
+}
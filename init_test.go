@@ -9,8 +9,15 @@ import (
 
 func TestUnitPhpNginx(t *testing.T) {
 	suite := spec.New("php-nginx", spec.Report(report.Terminal{}), spec.Parallel())
-	suite("Build", testBuild)
+	suite("Build", testBuild, spec.Sequential())
 	suite("Detect", testDetect, spec.Sequential())
 	suite("Config", testConfig, spec.Sequential())
+	suite("Fpm", testFpm, spec.Sequential())
+	suite("Framework", testFramework, spec.Sequential())
+	suite("Limits", testLimits)
+	suite("Linter", testLinter, spec.Sequential())
+	suite("Validator", testValidator, spec.Sequential())
+	suite("Preset", testPreset)
+	suite("Render", testRender, spec.Sequential())
 	suite.Run(t)
 }
@@ -70,7 +70,6 @@ func testDefault(t *testing.T, context spec.G, it spec.S) {
 					phpFpmBuildpack,
 					buildpack,
 					buildPlanBuildpack,
-					procfileBuildpack,
 				).
 				WithEnv(map[string]string{
 					"BP_LOG_LEVEL":  "DEBUG",
@@ -109,6 +108,11 @@ func testDefault(t *testing.T, context spec.G, it spec.S) {
 				`    PHP_NGINX_PATH -> "/workspace/nginx.conf"`,
 			))
 
+			Expect(logs).To(ContainLines(
+				"  Assigning launch processes:",
+				ContainSubstring("web (default):"),
+			))
+
 			container, err = docker.Container.Run.
 				WithEnv(map[string]string{"PORT": "8080"}).
 				WithPublish("8080").
@@ -11,7 +11,6 @@ import (
 	"github.com/BurntSushi/toml"
 	"github.com/onsi/gomega/format"
 	"github.com/paketo-buildpacks/occam"
-	"github.com/paketo-buildpacks/occam/packagers"
 	"github.com/sclevine/spec"
 	"github.com/sclevine/spec/report"
 
@@ -24,7 +23,6 @@ var (
 	nginxBuildpack     string
 	phpBuildpack       string
 	phpFpmBuildpack    string
-	procfileBuildpack  string
 
 	offlineBuildpack       string
 	offlineNginxBuildpack  string
@@ -51,7 +49,6 @@ func TestIntegration(t *testing.T) {
 		Nginx     string `json:"nginx"`
 		Php       string `json:"php"`
 		PhpFpm    string `json:"php-fpm"`
-		Procfile  string `json:"procfile"`
 	}
 
 	integrationFile, err := os.Open("../integration.json")
@@ -75,9 +72,7 @@ func TestIntegration(t *testing.T) {
 	Expect(err).ToNot(HaveOccurred())
 
 	buildpackStore := occam.NewBuildpackStore()
-	libpakBuildpackStore := occam.NewBuildpackStore().WithPackager(packagers.NewLibpak())
 	targetedBuildpackStore := buildpackStore.WithTarget("linux/" + runtime.GOARCH)
-	targetedLibpakBuildpackStore := libpakBuildpackStore.WithTarget("linux/" + runtime.GOARCH)
 
 	buildpack, err = buildpackStore.Get.
 		WithVersion("1.2.3").
@@ -121,10 +116,6 @@ func TestIntegration(t *testing.T) {
 		Execute(config.PhpFpm)
 	Expect(err).NotTo(HaveOccurred())
 
-	procfileBuildpack, err = targetedLibpakBuildpackStore.Get.
-		Execute(config.Procfile)
-	Expect(err).NotTo(HaveOccurred())
-
 	SetDefaultEventuallyTimeout(10 * time.Second)
 
 	suite := spec.New("Integration", spec.Report(report.Terminal{}), spec.Parallel())
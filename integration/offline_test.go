@@ -70,7 +70,6 @@ func testOffline(t *testing.T, context spec.G, it spec.S) {
 					offlinePhpFpmBuildpack,
 					offlineBuildpack,
 					buildPlanBuildpack,
-					procfileBuildpack,
 				).
 				WithEnv(map[string]string{
 					"BP_LOG_LEVEL":  "DEBUG",
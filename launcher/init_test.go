@@ -0,0 +1,16 @@
+package launcher_test
+
+import (
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitLauncher(t *testing.T) {
+	suite := spec.New("launcher", spec.Report(report.Terminal{}), spec.Parallel())
+	suite("Options", testOptions, spec.Sequential())
+	suite("Process", testProcess, spec.Sequential())
+	suite("Supervisor", testSupervisor, spec.Sequential())
+	suite.Run(t)
+}
@@ -0,0 +1,92 @@
+package launcher
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultShutdownTimeout is how long each server is given to stop gracefully
+// before it is killed. It leaves room for both servers within the default
+// Kubernetes termination grace period of 30 seconds.
+const DefaultShutdownTimeout = 10 * time.Second
+
+// DefaultStartupTimeout is how long FPM is given to start accepting
+// connections before the launcher gives up.
+const DefaultStartupTimeout = 30 * time.Second
+
+// Options configure the Supervisor.
+type Options struct {
+	// LogPrefix prefixes each line of output with the name of the process that
+	// wrote it.
+	LogPrefix bool
+
+	// ShutdownTimeout is how long each process is given to exit after SIGQUIT
+	// before it is killed.
+	ShutdownTimeout time.Duration
+
+	// StartupTimeout is how long a process with an address is given to
+	// accept connections before the supervisor gives up.
+	StartupTimeout time.Duration
+}
+
+// LoadOptions returns the options set at launch-time through
+// $BPL_PHP_NGINX_LOG_PREFIX, $BPL_PHP_NGINX_SHUTDOWN_TIMEOUT and
+// $BPL_PHP_NGINX_STARTUP_TIMEOUT.
+func LoadOptions() (Options, error) {
+	options := Options{
+		ShutdownTimeout: DefaultShutdownTimeout,
+		StartupTimeout:  DefaultStartupTimeout,
+	}
+
+	if value, ok := os.LookupEnv("BPL_PHP_NGINX_LOG_PREFIX"); ok {
+		logPrefix, err := strconv.ParseBool(value)
+		if err != nil {
+			return Options{}, fmt.Errorf("failed to parse $BPL_PHP_NGINX_LOG_PREFIX into boolean: %w", err)
+		}
+		options.LogPrefix = logPrefix
+	}
+
+	if value, ok := os.LookupEnv("BPL_PHP_NGINX_SHUTDOWN_TIMEOUT"); ok {
+		timeout, err := ParseTimeout(value)
+		if err != nil {
+			return Options{}, fmt.Errorf("failed to parse $BPL_PHP_NGINX_SHUTDOWN_TIMEOUT: %w", err)
+		}
+		options.ShutdownTimeout = timeout
+	}
+
+	if value, ok := os.LookupEnv("BPL_PHP_NGINX_STARTUP_TIMEOUT"); ok {
+		timeout, err := ParseTimeout(value)
+		if err != nil {
+			return Options{}, fmt.Errorf("failed to parse $BPL_PHP_NGINX_STARTUP_TIMEOUT: %w", err)
+		}
+		options.StartupTimeout = timeout
+	}
+
+	return options, nil
+}
+
+// ParseTimeout parses a timeout given either as a number of seconds or as a
+// duration such as "90s" or "5m". Timeouts are rounded up to whole seconds
+// and must be at least one second. The buildpack parses its timeouts with it
+// as well, so that a value means the same at build-time and at launch-time.
+func ParseTimeout(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+
+	duration := value
+	if _, err := strconv.Atoi(value); err == nil {
+		duration += "s"
+	}
+
+	timeout, err := time.ParseDuration(duration)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number of seconds or a duration", value)
+	}
+	if timeout < time.Second {
+		return 0, fmt.Errorf("%q must be at least one second", value)
+	}
+
+	return (timeout + time.Second - 1).Truncate(time.Second), nil
+}
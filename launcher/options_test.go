@@ -0,0 +1,86 @@
+package launcher_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/paketo-buildpacks/php-nginx/launcher"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testOptions(t *testing.T, context spec.G, it spec.S) {
+	var Expect = NewWithT(t).Expect
+
+	it.After(func() {
+		Expect(os.Unsetenv("BPL_PHP_NGINX_LOG_PREFIX")).To(Succeed())
+		Expect(os.Unsetenv("BPL_PHP_NGINX_SHUTDOWN_TIMEOUT")).To(Succeed())
+		Expect(os.Unsetenv("BPL_PHP_NGINX_STARTUP_TIMEOUT")).To(Succeed())
+	})
+
+	it("returns the default options", func() {
+		options, err := launcher.LoadOptions()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(options).To(Equal(launcher.Options{
+			ShutdownTimeout: 10 * time.Second,
+			StartupTimeout:  30 * time.Second,
+		}))
+	})
+
+	it("returns the options set in the environment", func() {
+		Expect(os.Setenv("BPL_PHP_NGINX_LOG_PREFIX", "true")).To(Succeed())
+		Expect(os.Setenv("BPL_PHP_NGINX_SHUTDOWN_TIMEOUT", "25")).To(Succeed())
+		Expect(os.Setenv("BPL_PHP_NGINX_STARTUP_TIMEOUT", "2m")).To(Succeed())
+
+		options, err := launcher.LoadOptions()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(options).To(Equal(launcher.Options{
+			LogPrefix:       true,
+			ShutdownTimeout: 25 * time.Second,
+			StartupTimeout:  2 * time.Minute,
+		}))
+
+		Expect(os.Setenv("BPL_PHP_NGINX_SHUTDOWN_TIMEOUT", "1m30s")).To(Succeed())
+
+		options, err = launcher.LoadOptions()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(options.ShutdownTimeout).To(Equal(90 * time.Second))
+	})
+
+	context("failure cases", func() {
+		context("when BPL_PHP_NGINX_LOG_PREFIX cannot be parsed into a bool", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BPL_PHP_NGINX_LOG_PREFIX", "blah")).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := launcher.LoadOptions()
+				Expect(err).To(MatchError(ContainSubstring("failed to parse $BPL_PHP_NGINX_LOG_PREFIX into boolean:")))
+			})
+		})
+
+		context("when BPL_PHP_NGINX_SHUTDOWN_TIMEOUT is invalid", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BPL_PHP_NGINX_SHUTDOWN_TIMEOUT", "soon")).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := launcher.LoadOptions()
+				Expect(err).To(MatchError(`failed to parse $BPL_PHP_NGINX_SHUTDOWN_TIMEOUT: "soon" is not a number of seconds or a duration`))
+			})
+		})
+
+		context("when BPL_PHP_NGINX_STARTUP_TIMEOUT is invalid", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BPL_PHP_NGINX_STARTUP_TIMEOUT", "-5s")).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := launcher.LoadOptions()
+				Expect(err).To(MatchError(`failed to parse $BPL_PHP_NGINX_STARTUP_TIMEOUT: "-5s" must be at least one second`))
+			})
+		})
+	})
+}
@@ -0,0 +1,81 @@
+package launcher
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// FpmProcess returns the process that runs FPM in the foreground with the
+// configuration at $PHP_FPM_PATH, which is set by the FPM buildpack. When
+// $PHP_NGINX_FPM_ADDRESS is set to a comma-separated list of addresses, each
+// either "unix:" followed by a socket path or a host and port, FPM is ready
+// once it accepts connections on all of them, which covers the www pool and
+// any additional pools.
+func FpmProcess() (Process, error) {
+	path := os.Getenv("PHP_FPM_PATH")
+	if path == "" {
+		return Process{}, fmt.Errorf("$PHP_FPM_PATH is not set")
+	}
+
+	process := Process{
+		Name: "php-fpm",
+		Path: "php-fpm",
+		Args: []string{"-y", path, "-F"},
+	}
+
+	for _, address := range strings.Split(os.Getenv("PHP_NGINX_FPM_ADDRESS"), ",") {
+		address = strings.TrimSpace(address)
+		if address == "" {
+			continue
+		}
+
+		if socket, ok := strings.CutPrefix(address, "unix:"); ok {
+			process.Addresses = append(process.Addresses, Address{Network: "unix", Address: socket})
+		} else {
+			process.Addresses = append(process.Addresses, Address{Network: "tcp", Address: address})
+		}
+	}
+
+	return process, nil
+}
+
+// NginxProcess returns the process that runs Nginx with the configuration at
+// $PHP_NGINX_PATH and prefixDir as its prefix.
+func NginxProcess(prefixDir string) (Process, error) {
+	path := os.Getenv("PHP_NGINX_PATH")
+	if path == "" {
+		return Process{}, fmt.Errorf("$PHP_NGINX_PATH is not set")
+	}
+
+	return Process{
+		Name: "nginx",
+		Path: "nginx",
+		Args: []string{"-p", prefixDir, "-c", path},
+	}, nil
+}
+
+// ExporterProcess returns the process that serves the metrics of Nginx and
+// FPM on $PHP_NGINX_METRICS_ADDRESS, reading their statuses from the Nginx
+// server on $PHP_NGINX_STATUS_SOCKET. It returns false when the metrics are
+// not enabled.
+func ExporterProcess() (Process, bool) {
+	address := os.Getenv("PHP_NGINX_METRICS_ADDRESS")
+	if address == "" {
+		return Process{}, false
+	}
+
+	args := []string{"-listen", address}
+	if socket := os.Getenv("PHP_NGINX_STATUS_SOCKET"); socket != "" {
+		args = append(args, "-socket", socket)
+	}
+	if path := os.Getenv("PHP_NGINX_FPM_STATUS_PATH"); path != "" {
+		args = append(args, "-fpm-status-path", path)
+	}
+
+	return Process{
+		Name: "php-nginx-exporter",
+		Path: "php-nginx-exporter",
+		Args: args,
+	}, true
+}
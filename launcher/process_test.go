@@ -0,0 +1,122 @@
+package launcher_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/paketo-buildpacks/php-nginx/launcher"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testProcess(t *testing.T, context spec.G, it spec.S) {
+	var Expect = NewWithT(t).Expect
+
+	it.Before(func() {
+		Expect(os.Setenv("PHP_FPM_PATH", "/layers/php-fpm/php-fpm.conf")).To(Succeed())
+		Expect(os.Setenv("PHP_NGINX_PATH", "/workspace/nginx.conf")).To(Succeed())
+	})
+
+	it.After(func() {
+		Expect(os.Unsetenv("PHP_FPM_PATH")).To(Succeed())
+		Expect(os.Unsetenv("PHP_NGINX_PATH")).To(Succeed())
+		Expect(os.Unsetenv("PHP_NGINX_FPM_ADDRESS")).To(Succeed())
+	})
+
+	it("returns the FPM and Nginx processes", func() {
+		fpm, err := launcher.FpmProcess()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fpm).To(Equal(launcher.Process{
+			Name: "php-fpm",
+			Path: "php-fpm",
+			Args: []string{"-y", "/layers/php-fpm/php-fpm.conf", "-F"},
+		}))
+
+		nginx, err := launcher.NginxProcess("/workspace")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nginx).To(Equal(launcher.Process{
+			Name: "nginx",
+			Path: "nginx",
+			Args: []string{"-p", "/workspace", "-c", "/workspace/nginx.conf"},
+		}))
+	})
+
+	context("when PHP_NGINX_FPM_ADDRESS is set", func() {
+		it("waits for FPM to accept connections on the unix socket", func() {
+			Expect(os.Setenv("PHP_NGINX_FPM_ADDRESS", "unix:/tmp/php-fpm.socket")).To(Succeed())
+
+			fpm, err := launcher.FpmProcess()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fpm.Addresses).To(Equal([]launcher.Address{{Network: "unix", Address: "/tmp/php-fpm.socket"}}))
+		})
+
+		it("waits for FPM to accept connections on the TCP address", func() {
+			Expect(os.Setenv("PHP_NGINX_FPM_ADDRESS", "127.0.0.1:9000")).To(Succeed())
+
+			fpm, err := launcher.FpmProcess()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fpm.Addresses).To(Equal([]launcher.Address{{Network: "tcp", Address: "127.0.0.1:9000"}}))
+		})
+
+		it("waits for FPM to accept connections on the address of every pool", func() {
+			Expect(os.Setenv("PHP_NGINX_FPM_ADDRESS", "unix:/tmp/php-fpm.socket,unix:/tmp/php-fpm-admin.socket, 127.0.0.1:9001")).To(Succeed())
+
+			fpm, err := launcher.FpmProcess()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fpm.Addresses).To(Equal([]launcher.Address{
+				{Network: "unix", Address: "/tmp/php-fpm.socket"},
+				{Network: "unix", Address: "/tmp/php-fpm-admin.socket"},
+				{Network: "tcp", Address: "127.0.0.1:9001"},
+			}))
+		})
+	})
+
+	context("when PHP_NGINX_METRICS_ADDRESS is set", func() {
+		it.Before(func() {
+			Expect(os.Setenv("PHP_NGINX_METRICS_ADDRESS", ":9113")).To(Succeed())
+			Expect(os.Setenv("PHP_NGINX_STATUS_SOCKET", "/tmp/php-nginx-status.socket")).To(Succeed())
+			Expect(os.Setenv("PHP_NGINX_FPM_STATUS_PATH", "/status")).To(Succeed())
+		})
+
+		it.After(func() {
+			Expect(os.Unsetenv("PHP_NGINX_METRICS_ADDRESS")).To(Succeed())
+			Expect(os.Unsetenv("PHP_NGINX_STATUS_SOCKET")).To(Succeed())
+			Expect(os.Unsetenv("PHP_NGINX_FPM_STATUS_PATH")).To(Succeed())
+		})
+
+		it("returns the metrics exporter process", func() {
+			exporter, ok := launcher.ExporterProcess()
+			Expect(ok).To(BeTrue())
+			Expect(exporter).To(Equal(launcher.Process{
+				Name: "php-nginx-exporter",
+				Path: "php-nginx-exporter",
+				Args: []string{"-listen", ":9113", "-socket", "/tmp/php-nginx-status.socket", "-fpm-status-path", "/status"},
+			}))
+		})
+	})
+
+	context("when PHP_NGINX_METRICS_ADDRESS is not set", func() {
+		it("does not return the metrics exporter process", func() {
+			_, ok := launcher.ExporterProcess()
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	context("failure cases", func() {
+		context("when the configuration paths are not set", func() {
+			it.Before(func() {
+				Expect(os.Unsetenv("PHP_FPM_PATH")).To(Succeed())
+				Expect(os.Unsetenv("PHP_NGINX_PATH")).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := launcher.FpmProcess()
+				Expect(err).To(MatchError("$PHP_FPM_PATH is not set"))
+
+				_, err = launcher.NginxProcess("/workspace")
+				Expect(err).To(MatchError("$PHP_NGINX_PATH is not set"))
+			})
+		})
+	})
+}
@@ -0,0 +1,10 @@
+package launcher
+
+import "golang.org/x/sys/unix"
+
+// becomeSubreaper makes the supervisor adopt the orphaned descendants of its
+// children, such as FPM workers whose master died, so that it can reap them
+// even when it is not PID 1.
+func becomeSubreaper() error {
+	return unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0)
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package launcher
+
+// becomeSubreaper is a no-op on platforms without child subreapers.
+func becomeSubreaper() error {
+	return nil
+}
@@ -0,0 +1,413 @@
+package launcher
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// readinessInterval is how often the supervisor checks whether a process
+// accepts connections while it starts.
+const readinessInterval = 100 * time.Millisecond
+
+// logDrainTimeout bounds how long the supervisor waits for the remaining
+// output of its children once they have all exited.
+const logDrainTimeout = time.Second
+
+// Process is a server started and supervised by the Supervisor.
+type Process struct {
+	Name string
+	Path string
+	Args []string
+
+	// Addresses, when set, are where the process accepts connections once it
+	// is ready. It is only ready once it accepts them on all of them.
+	Addresses []Address
+}
+
+// Address is where a process accepts connections, e.g. "unix" and
+// "/tmp/php-fpm.socket".
+type Address struct {
+	Network string
+	Address string
+}
+
+// Supervisor runs a set of servers as its children. It starts them in order,
+// stops them gracefully in reverse order when it receives a signal, reaps
+// every process that is re-parented to it and shuts everything down when one
+// of the servers exits on its own.
+type Supervisor struct {
+	stdout  *lineWriter
+	stderr  *lineWriter
+	options Options
+}
+
+func NewSupervisor(stdout, stderr io.Writer, options Options) Supervisor {
+	var mutex sync.Mutex
+	return Supervisor{
+		stdout:  &lineWriter{writer: stdout, mutex: &mutex},
+		stderr:  &lineWriter{writer: stderr, mutex: &mutex},
+		options: options,
+	}
+}
+
+type child struct {
+	Process
+	pid    int
+	exited bool
+}
+
+type exit struct {
+	pid    int
+	status syscall.WaitStatus
+}
+
+// Run starts the processes in order and supervises them until they have all
+// exited. When a process has an address, Run waits until it accepts
+// connections there before starting the next process. Receiving a value on
+// signals stops the processes in reverse order by sending each one SIGQUIT
+// and waiting for it to exit, or killing it after the shutdown timeout. Run
+// returns an error when one of the processes exits without having been asked
+// to or does not become ready within the startup timeout.
+func (s Supervisor) Run(signals <-chan os.Signal, processes ...Process) error {
+	err := becomeSubreaper()
+	if err != nil {
+		return fmt.Errorf("failed to become a subreaper: %w", err)
+	}
+
+	var (
+		children []*child
+		exits    <-chan exit
+		logs     sync.WaitGroup
+	)
+
+	done := make(chan struct{})
+	defer close(done)
+
+	for _, process := range processes {
+		pid, err := s.start(process, &logs)
+		if err != nil {
+			s.log("failed to start %s: %s", process.Name, err)
+			s.stop(children, exits)
+			return fmt.Errorf("failed to start %s: %w", process.Name, err)
+		}
+
+		c := &child{Process: process, pid: pid}
+		children = append(children, c)
+
+		// The reaper stops once there are no children left, so it is only
+		// started once there is at least one.
+		if exits == nil {
+			exits = reap(done)
+		}
+
+		if len(process.Addresses) > 0 {
+			signal, err := s.waitUntilReady(c, children, exits, signals)
+			if err != nil {
+				s.log("%s", err)
+				s.stop(children, exits)
+				drain(&logs)
+				return err
+			}
+			if signal != nil {
+				s.log("received %s, stopping", signal)
+				s.stop(children, exits)
+				drain(&logs)
+				return nil
+			}
+		}
+	}
+
+	var failure error
+	for failure == nil {
+		select {
+		case signal := <-signals:
+			s.log("received %s, stopping", signal)
+			s.stop(children, exits)
+			drain(&logs)
+			return nil
+
+		case exit, ok := <-exits:
+			if !ok {
+				return errors.New("all processes exited unexpectedly")
+			}
+
+			failure = exited(children, exit)
+			if failure != nil {
+				s.log("%s", failure)
+			}
+		}
+	}
+
+	s.stop(children, exits)
+	drain(&logs)
+
+	return failure
+}
+
+// waitUntilReady waits until c accepts connections on each of its addresses.
+// It returns the signal that interrupted the wait, if any, or an error when a
+// process exits or c is not ready within the startup timeout.
+func (s Supervisor) waitUntilReady(c *child, children []*child, exits <-chan exit, signals <-chan os.Signal) (os.Signal, error) {
+	var addresses []string
+	for _, address := range c.Addresses {
+		addresses = append(addresses, address.Address)
+	}
+	s.log("waiting for %s to accept connections on %s", c.Name, strings.Join(addresses, ", "))
+
+	ticker := time.NewTicker(readinessInterval)
+	defer ticker.Stop()
+
+	deadline := time.After(s.options.StartupTimeout)
+	for _, address := range c.Addresses {
+		for !accepts(address) {
+			select {
+			case signal := <-signals:
+				return signal, nil
+
+			case exit, ok := <-exits:
+				if !ok {
+					return nil, errors.New("all processes exited unexpectedly")
+				}
+
+				err := exited(children, exit)
+				if err != nil {
+					return nil, err
+				}
+
+			case <-deadline:
+				return nil, fmt.Errorf("%s did not accept connections on %s within %s", c.Name, address.Address, s.options.StartupTimeout)
+
+			case <-ticker.C:
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// accepts reports whether a connection to address succeeds.
+func accepts(address Address) bool {
+	connection, err := net.DialTimeout(address.Network, address.Address, readinessInterval)
+	if err != nil {
+		return false
+	}
+	_ = connection.Close()
+
+	return true
+}
+
+func (s Supervisor) start(process Process, logs *sync.WaitGroup) (int, error) {
+	stdout, err := s.pipe(process.Name, s.stdout, logs)
+	if err != nil {
+		return 0, err
+	}
+	defer stdout.Close()
+
+	stderr, err := s.pipe(process.Name, s.stderr, logs)
+	if err != nil {
+		return 0, err
+	}
+	defer stderr.Close()
+
+	cmd := exec.Command(process.Path, process.Args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// Keep terminal signals, such as Ctrl-C, from reaching the children
+	// directly so that they are always stopped in order.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	err = cmd.Start()
+	if err != nil {
+		return 0, err
+	}
+
+	return cmd.Process.Pid, nil
+}
+
+// pipe returns the write end of a pipe whose output is copied, line by line,
+// to w.
+func (s Supervisor) pipe(name string, w *lineWriter, logs *sync.WaitGroup) (*os.File, error) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := ""
+	if s.options.LogPrefix {
+		prefix = fmt.Sprintf("[%s] ", name)
+	}
+
+	logs.Add(1)
+	go func() {
+		defer logs.Done()
+		defer reader.Close()
+		w.copyLines(reader, prefix)
+	}()
+
+	return writer, nil
+}
+
+// stop stops the children that are still running in reverse order.
+func (s Supervisor) stop(children []*child, exits <-chan exit) {
+	for i := len(children) - 1; i >= 0; i-- {
+		c := children[i]
+		if c.exited {
+			continue
+		}
+
+		s.log("stopping %s", c.Name)
+		err := syscall.Kill(c.pid, syscall.SIGQUIT)
+		if err != nil {
+			// untested
+			s.log("failed to stop %s: %s", c.Name, err)
+		}
+
+		timeout := time.After(s.options.ShutdownTimeout)
+		for !c.exited {
+			select {
+			case exit, ok := <-exits:
+				if !ok {
+					return
+				}
+				if e := find(children, exit.pid); e != nil {
+					e.exited = true
+				}
+
+			case <-timeout:
+				s.log("%s did not stop within %s, killing it", c.Name, s.options.ShutdownTimeout)
+				_ = syscall.Kill(c.pid, syscall.SIGKILL)
+				timeout = nil
+			}
+		}
+	}
+}
+
+func (s Supervisor) log(format string, args ...interface{}) {
+	s.stderr.writeLine(fmt.Sprintf("php-nginx-launcher: "+format+"\n", args...))
+}
+
+// reap waits for every child process, including those re-parented to the
+// supervisor, and reports their exits until there are no children left or
+// done is closed. It only waits without blocking, whenever a SIGCHLD
+// arrives, so that it stops as soon as done is closed instead of taking the
+// exit of a process started afterwards.
+func reap(done <-chan struct{}) <-chan exit {
+	children := make(chan os.Signal, 1)
+	signal.Notify(children, syscall.SIGCHLD)
+
+	exits := make(chan exit)
+	go func() {
+		defer close(exits)
+		defer signal.Stop(children)
+		for {
+			for {
+				var status syscall.WaitStatus
+				pid, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+				if errors.Is(err, syscall.EINTR) {
+					continue
+				}
+				if err != nil {
+					return
+				}
+				if pid <= 0 {
+					break
+				}
+
+				select {
+				case exits <- exit{pid: pid, status: status}:
+				case <-done:
+					return
+				}
+			}
+
+			select {
+			case <-children:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return exits
+}
+
+// exited records the exit of a supervised process and returns an error
+// describing it. Exits of other processes, such as orphans that were
+// re-parented to the supervisor, are ignored.
+func exited(children []*child, exit exit) error {
+	c := find(children, exit.pid)
+	if c == nil {
+		return nil
+	}
+	c.exited = true
+
+	return fmt.Errorf("%s exited unexpectedly with %s", c.Name, describe(exit.status))
+}
+
+func find(children []*child, pid int) *child {
+	for _, c := range children {
+		if c.pid == pid {
+			return c
+		}
+	}
+	return nil
+}
+
+func describe(status syscall.WaitStatus) string {
+	if status.Signaled() {
+		return fmt.Sprintf("signal %s", status.Signal())
+	}
+	return fmt.Sprintf("status %d", status.ExitStatus())
+}
+
+func drain(logs *sync.WaitGroup) {
+	done := make(chan struct{})
+	go func() {
+		logs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(logDrainTimeout):
+	}
+}
+
+// lineWriter serializes whole lines from several sources onto one writer so
+// that the output of the children does not interleave mid-line.
+type lineWriter struct {
+	writer io.Writer
+	mutex  *sync.Mutex
+}
+
+func (w *lineWriter) copyLines(r io.Reader, prefix string) {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			if line[len(line)-1] != '\n' {
+				line += "\n"
+			}
+			w.writeLine(prefix + line)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (w *lineWriter) writeLine(line string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	_, _ = io.WriteString(w.writer, line)
+}
@@ -0,0 +1,346 @@
+package launcher_test
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/paketo-buildpacks/php-nginx/launcher"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+// server returns a process that prints when it starts and when it is stopped
+// with SIGQUIT. It also appends both to the events file, which, unlike the
+// output of several processes, keeps them in the order in which they happened.
+func server(name, events string) launcher.Process {
+	return launcher.Process{
+		Name: name,
+		Path: "sh",
+		Args: []string{"-c", fmt.Sprintf(`trap 'echo %[1]s stopped; echo %[1]s stopped >> %[2]q; exit 0' QUIT; echo %[1]s started; echo %[1]s started >> %[2]q; while true; do sleep 0.05; done`, name, events)},
+	}
+}
+
+// started reports whether each of the names has recorded in the events file
+// that it started.
+func started(events string, names ...string) bool {
+	contents, err := os.ReadFile(events)
+	if err != nil {
+		return false
+	}
+
+	for _, name := range names {
+		if !strings.Contains(string(contents), name+" started\n") {
+			return false
+		}
+	}
+
+	return true
+}
+
+func testSupervisor(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		eventsDir string
+		events    string
+		stdout    *bytes.Buffer
+		stderr    *bytes.Buffer
+		signals   chan os.Signal
+		options   launcher.Options
+	)
+
+	it.Before(func() {
+		var err error
+		eventsDir, err = os.MkdirTemp("", "events")
+		Expect(err).NotTo(HaveOccurred())
+		events = filepath.Join(eventsDir, "events")
+
+		stdout = bytes.NewBuffer(nil)
+		stderr = bytes.NewBuffer(nil)
+		signals = make(chan os.Signal, 1)
+		options = launcher.Options{ShutdownTimeout: 5 * time.Second}
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(eventsDir)).To(Succeed())
+	})
+
+	context("when it receives a signal", func() {
+		it.Before(func() {
+			go func() {
+				deadline := time.Now().Add(10 * time.Second)
+				for !started(events, "php-fpm", "nginx") && time.Now().Before(deadline) {
+					time.Sleep(10 * time.Millisecond)
+				}
+				signals <- syscall.SIGTERM
+			}()
+		})
+
+		it("stops the processes in reverse order", func() {
+			err := launcher.NewSupervisor(stdout, stderr, options).Run(signals, server("php-fpm", events), server("nginx", events))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(stdout.String()).To(ContainSubstring("php-fpm started\n"))
+			Expect(stdout.String()).To(ContainSubstring("nginx started\n"))
+			Expect(stdout.String()).To(ContainSubstring("nginx stopped\n"))
+			Expect(stdout.String()).To(ContainSubstring("php-fpm stopped\n"))
+			Expect(stderr.String()).To(ContainSubstring("php-nginx-launcher: received terminated, stopping\n"))
+			Expect(stderr.String()).To(ContainSubstring("php-nginx-launcher: stopping nginx\nphp-nginx-launcher: stopping php-fpm\n"))
+
+			contents, err := os.ReadFile(events)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(HaveSuffix("nginx stopped\nphp-fpm stopped\n"))
+		})
+
+		context("when log prefixes are enabled", func() {
+			it.Before(func() {
+				options.LogPrefix = true
+			})
+
+			it("prefixes each line with the name of the process", func() {
+				err := launcher.NewSupervisor(stdout, stderr, options).Run(signals, server("php-fpm", events), server("nginx", events))
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(stdout.String()).To(ContainSubstring("[php-fpm] php-fpm started\n"))
+				Expect(stdout.String()).To(ContainSubstring("[nginx] nginx stopped\n"))
+				Expect(stdout.String()).To(ContainSubstring("[php-fpm] php-fpm stopped\n"))
+			})
+		})
+
+		context("when a process does not stop in time", func() {
+			it.Before(func() {
+				options.ShutdownTimeout = 200 * time.Millisecond
+			})
+
+			it("kills it", func() {
+				stubborn := launcher.Process{
+					Name: "nginx",
+					Path: "sh",
+					Args: []string{"-c", fmt.Sprintf(`trap '' QUIT; echo nginx started >> %q; while true; do sleep 0.05; done`, events)},
+				}
+
+				err := launcher.NewSupervisor(stdout, stderr, options).Run(signals, server("php-fpm", events), stubborn)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(stderr.String()).To(ContainSubstring("php-nginx-launcher: nginx did not stop within 200ms, killing it\n"))
+				Expect(stdout.String()).To(ContainSubstring("php-fpm stopped\n"))
+
+				contents, err := os.ReadFile(events)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(HaveSuffix("php-fpm stopped\n"))
+			})
+		})
+	})
+
+	context("when a process has an address", func() {
+		var (
+			socketDir string
+			socket    string
+			fpm       launcher.Process
+			nginx     launcher.Process
+		)
+
+		it.Before(func() {
+			var err error
+			socketDir, err = os.MkdirTemp("", "sockets")
+			Expect(err).NotTo(HaveOccurred())
+
+			socket = filepath.Join(socketDir, "php-fpm.socket")
+			fpm = server("php-fpm", events)
+			fpm.Addresses = []launcher.Address{{Network: "unix", Address: socket}}
+
+			nginx = launcher.Process{
+				Name: "nginx",
+				Path: "sh",
+				Args: []string{"-c", fmt.Sprintf(`test -S %s && echo nginx saw socket; exit 3`, socket)},
+			}
+
+			options.StartupTimeout = 5 * time.Second
+		})
+
+		it.After(func() {
+			Expect(os.RemoveAll(socketDir)).To(Succeed())
+		})
+
+		it("starts the next process once it accepts connections", func() {
+			go func() {
+				time.Sleep(300 * time.Millisecond)
+				listener, err := net.Listen("unix", socket)
+				if err == nil {
+					defer listener.Close()
+					time.Sleep(2 * time.Second)
+				}
+			}()
+
+			err := launcher.NewSupervisor(stdout, stderr, options).Run(signals, fpm, nginx)
+			Expect(err).To(MatchError("nginx exited unexpectedly with status 3"))
+
+			Expect(stderr.String()).To(ContainSubstring(fmt.Sprintf("php-nginx-launcher: waiting for php-fpm to accept connections on %s\n", socket)))
+			Expect(stdout.String()).To(ContainSubstring("nginx saw socket\n"))
+		})
+
+		context("when it has several addresses", func() {
+			var adminSocket string
+
+			it.Before(func() {
+				adminSocket = filepath.Join(socketDir, "php-fpm-admin.socket")
+				fpm.Addresses = append(fpm.Addresses, launcher.Address{Network: "unix", Address: adminSocket})
+
+				nginx.Args = []string{"-c", fmt.Sprintf(`test -S %s && test -S %s && echo nginx saw sockets; exit 3`, socket, adminSocket)}
+			})
+
+			it("starts the next process once it accepts connections on all of them", func() {
+				go func() {
+					listener, err := net.Listen("unix", socket)
+					if err == nil {
+						defer listener.Close()
+						time.Sleep(300 * time.Millisecond)
+
+						adminListener, err := net.Listen("unix", adminSocket)
+						if err == nil {
+							defer adminListener.Close()
+							time.Sleep(2 * time.Second)
+						}
+					}
+				}()
+
+				err := launcher.NewSupervisor(stdout, stderr, options).Run(signals, fpm, nginx)
+				Expect(err).To(MatchError("nginx exited unexpectedly with status 3"))
+
+				Expect(stderr.String()).To(ContainSubstring(fmt.Sprintf("php-nginx-launcher: waiting for php-fpm to accept connections on %s, %s\n", socket, adminSocket)))
+				Expect(stdout.String()).To(ContainSubstring("nginx saw sockets\n"))
+			})
+
+			context("when it never accepts connections on one of them", func() {
+				it.Before(func() {
+					options.StartupTimeout = 300 * time.Millisecond
+				})
+
+				it("returns an error naming that address", func() {
+					listener, err := net.Listen("unix", socket)
+					Expect(err).NotTo(HaveOccurred())
+					defer listener.Close()
+
+					err = launcher.NewSupervisor(stdout, stderr, options).Run(signals, fpm, nginx)
+					Expect(err).To(MatchError(fmt.Sprintf("php-fpm did not accept connections on %s within 300ms", adminSocket)))
+
+					Expect(stdout.String()).NotTo(ContainSubstring("nginx"))
+				})
+			})
+		})
+
+		context("when it never accepts connections", func() {
+			it.Before(func() {
+				options.StartupTimeout = 300 * time.Millisecond
+			})
+
+			it("stops it without starting the next process and returns an error", func() {
+				err := launcher.NewSupervisor(stdout, stderr, options).Run(signals, fpm, nginx)
+				Expect(err).To(MatchError(fmt.Sprintf("php-fpm did not accept connections on %s within 300ms", socket)))
+
+				Expect(stderr.String()).To(ContainSubstring("php-nginx-launcher: stopping php-fpm\n"))
+				Expect(stdout.String()).NotTo(ContainSubstring("nginx"))
+			})
+		})
+
+		context("when it exits while starting", func() {
+			it.Before(func() {
+				fpm.Args = []string{"-c", "sleep 0.2; exit 78"}
+			})
+
+			it("returns an error without starting the next process", func() {
+				err := launcher.NewSupervisor(stdout, stderr, options).Run(signals, fpm, nginx)
+				Expect(err).To(MatchError("php-fpm exited unexpectedly with status 78"))
+
+				Expect(stdout.String()).NotTo(ContainSubstring("nginx"))
+			})
+		})
+
+		context("when it receives a signal while starting", func() {
+			it.Before(func() {
+				go func() {
+					time.Sleep(300 * time.Millisecond)
+					signals <- syscall.SIGTERM
+				}()
+			})
+
+			it("stops it without starting the next process", func() {
+				err := launcher.NewSupervisor(stdout, stderr, options).Run(signals, fpm, nginx)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(stdout.String()).To(HaveSuffix("php-fpm stopped\n"))
+				Expect(stdout.String()).NotTo(ContainSubstring("nginx"))
+			})
+		})
+	})
+
+	context("when a process exits on its own", func() {
+		it("stops the other processes and returns an error", func() {
+			crashing := launcher.Process{
+				Name: "nginx",
+				Path: "sh",
+				Args: []string{"-c", "sleep 0.2; exit 3"},
+			}
+
+			err := launcher.NewSupervisor(stdout, stderr, options).Run(signals, server("php-fpm", events), crashing)
+			Expect(err).To(MatchError("nginx exited unexpectedly with status 3"))
+
+			Expect(stdout.String()).To(HaveSuffix("php-fpm stopped\n"))
+			Expect(stderr.String()).To(ContainSubstring("php-nginx-launcher: stopping php-fpm\n"))
+		})
+
+		it("reports processes killed by a signal", func() {
+			crashing := launcher.Process{
+				Name: "php-fpm",
+				Path: "sh",
+				Args: []string{"-c", "sleep 0.2; kill -SEGV $$"},
+			}
+
+			err := launcher.NewSupervisor(stdout, stderr, options).Run(signals, crashing, server("nginx", events))
+			Expect(err).To(MatchError("php-fpm exited unexpectedly with signal segmentation fault"))
+
+			Expect(stdout.String()).To(HaveSuffix("nginx stopped\n"))
+		})
+	})
+
+	context("when a process leaves orphans behind", func() {
+		it("reaps them", func() {
+			orphaning := launcher.Process{
+				Name: "php-fpm",
+				Path: "sh",
+				Args: []string{"-c", "(sleep 0.1 &); sleep 0.3; exit 1"},
+			}
+
+			err := launcher.NewSupervisor(stdout, stderr, options).Run(signals, orphaning)
+			Expect(err).To(MatchError("php-fpm exited unexpectedly with status 1"))
+
+			var status syscall.WaitStatus
+			_, err = syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+			Expect(err).To(MatchError(syscall.ECHILD))
+		})
+	})
+
+	context("failure cases", func() {
+		context("when a process cannot be started", func() {
+			it("stops the processes that were started and returns an error", func() {
+				missing := launcher.Process{
+					Name: "nginx",
+					Path: "/no/such/nginx",
+				}
+
+				err := launcher.NewSupervisor(stdout, stderr, options).Run(signals, server("php-fpm", events), missing)
+				Expect(err).To(MatchError(ContainSubstring("failed to start nginx:")))
+
+				Expect(stderr.String()).To(ContainSubstring("php-nginx-launcher: stopping php-fpm\n"))
+			})
+		})
+	})
+}
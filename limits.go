@@ -0,0 +1,225 @@
+package phpnginx
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxWorkerRlimitNofile caps the open file limit given to Nginx workers
+	// when the hard limit is very large or unlimited.
+	maxWorkerRlimitNofile = 65536
+
+	// maxWorkerConnections caps the connections per worker derived from the
+	// open file limit.
+	maxWorkerConnections = 4096
+
+	// unlimitedMemory is the smallest memory limit treated as no limit;
+	// cgroup v1 reports a page-aligned maximum 64-bit integer instead of
+	// "max".
+	unlimitedMemory = 1 << 62
+)
+
+// ContainerLimits are the resources available to the container at launch.
+// A zero value means the limit is unknown.
+type ContainerLimits struct {
+	CPUs      int
+	OpenFiles uint64
+	Memory    uint64
+}
+
+// LoadContainerLimits reads the CPU quota and the memory limit from the
+// cgroup v2 or v1 hierarchy mounted at cgroupRoot, and the open file limit of
+// the current process. CPUs is the quota rounded up, or the number of CPUs the process
+// may run on when that is lower or there is no quota. OpenFiles is the hard
+// limit, which Nginx workers are allowed to raise their soft limit to.
+func LoadContainerLimits(cgroupRoot string) (ContainerLimits, error) {
+	cpus := runtime.NumCPU()
+
+	quota, err := loadCPUQuota(cgroupRoot)
+	if err != nil {
+		return ContainerLimits{}, err
+	}
+	if quota > 0 && quota < cpus {
+		cpus = quota
+	}
+
+	memory, err := loadMemoryLimit(cgroupRoot)
+	if err != nil {
+		return ContainerLimits{}, err
+	}
+
+	openFiles, err := openFileLimit()
+	if err != nil {
+		return ContainerLimits{}, fmt.Errorf("failed to get the open file limit: %w", err)
+	}
+
+	return ContainerLimits{
+		CPUs:      cpus,
+		OpenFiles: openFiles,
+		Memory:    memory,
+	}, nil
+}
+
+// WorkerRlimitNofile returns the open file limit for each Nginx worker.
+func (l ContainerLimits) WorkerRlimitNofile() int {
+	if l.OpenFiles > maxWorkerRlimitNofile {
+		return maxWorkerRlimitNofile
+	}
+	return int(l.OpenFiles)
+}
+
+// workerConnectionsFor returns the number of connections a worker can handle
+// with the given open file limit. Every proxied request uses two files, one
+// for the client and one for FPM.
+func workerConnectionsFor(rlimitNofile int) int {
+	connections := rlimitNofile / 2
+	if connections > maxWorkerConnections {
+		connections = maxWorkerConnections
+	}
+	if connections < 1 {
+		connections = 1
+	}
+	return connections
+}
+
+// loadCPUQuota returns the CPU quota of the cgroup rounded up to a whole
+// number of CPUs, or 0 when there is none.
+func loadCPUQuota(cgroupRoot string) (int, error) {
+	// cgroup v2: "<quota> <period>", where the quota may be "max"
+	path := filepath.Join(cgroupRoot, "cpu.max")
+	content, err := os.ReadFile(path)
+	if err == nil {
+		fields := strings.Fields(string(content))
+		if len(fields) != 2 {
+			return 0, fmt.Errorf("failed to parse %s: %q is not a quota and a period", path, strings.TrimSpace(string(content)))
+		}
+		if fields[0] == "max" {
+			return 0, nil
+		}
+		return cpuQuota(path, fields[0], fields[1])
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return 0, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	// cgroup v1: the quota is -1 when there is none
+	for _, controller := range []string{"cpu", "cpu,cpuacct"} {
+		quotaPath := filepath.Join(cgroupRoot, controller, "cpu.cfs_quota_us")
+		quota, err := os.ReadFile(quotaPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read %s: %w", quotaPath, err)
+		}
+
+		periodPath := filepath.Join(cgroupRoot, controller, "cpu.cfs_period_us")
+		period, err := os.ReadFile(periodPath)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read %s: %w", periodPath, err)
+		}
+
+		if strings.TrimSpace(string(quota)) == "-1" {
+			return 0, nil
+		}
+		return cpuQuota(quotaPath, strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+	}
+
+	return 0, nil
+}
+
+func cpuQuota(path, quota, period string) (int, error) {
+	q, err := strconv.ParseInt(quota, 10, 64)
+	if err != nil || q <= 0 {
+		return 0, fmt.Errorf("failed to parse %s: %q is not a positive quota", path, quota)
+	}
+
+	p, err := strconv.ParseInt(period, 10, 64)
+	if err != nil || p <= 0 {
+		return 0, fmt.Errorf("failed to parse %s: %q is not a positive period", path, period)
+	}
+
+	return int((q + p - 1) / p), nil
+}
+
+// loadMemoryLimit returns the memory limit of the cgroup in bytes, or 0 when
+// there is none.
+func loadMemoryLimit(cgroupRoot string) (uint64, error) {
+	for _, path := range []string{
+		filepath.Join(cgroupRoot, "memory.max"),
+		filepath.Join(cgroupRoot, "memory", "memory.limit_in_bytes"),
+	} {
+		content, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		value := strings.TrimSpace(string(content))
+		if value == "max" {
+			return 0, nil
+		}
+
+		limit, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse %s: %q is not a number of bytes", path, value)
+		}
+		if limit >= unlimitedMemory {
+			return 0, nil
+		}
+
+		return limit, nil
+	}
+
+	return 0, nil
+}
+
+// parseMemorySize parses a size in bytes with an optional K, M or G suffix,
+// such as "64M".
+func parseMemorySize(value string) (uint64, error) {
+	size, ok := parseSize(value)
+	if !ok || size == 0 {
+		return 0, fmt.Errorf("%q is not a size such as 64M", strings.TrimSpace(value))
+	}
+
+	return size, nil
+}
+
+// parseSize parses a size in bytes with an optional, case-insensitive K, M or
+// G suffix, as used by both Nginx and PHP.
+func parseSize(value string) (uint64, bool) {
+	value = strings.TrimSpace(value)
+
+	digits, multiplier := value, uint64(1)
+	if value != "" {
+		switch strings.ToUpper(value[len(value)-1:]) {
+		case "K":
+			digits, multiplier = value[:len(value)-1], 1<<10
+		case "M":
+			digits, multiplier = value[:len(value)-1], 1<<20
+		case "G":
+			digits, multiplier = value[:len(value)-1], 1<<30
+		}
+	}
+
+	size, err := strconv.ParseUint(digits, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return size * multiplier, true
+}
+
+// formatMemorySize formats a size in bytes in whole mebibytes.
+func formatMemorySize(size uint64) string {
+	return fmt.Sprintf("%dM", size>>20)
+}
@@ -0,0 +1,14 @@
+package phpnginx
+
+import "golang.org/x/sys/unix"
+
+// openFileLimit returns the hard limit on open files of the current process.
+func openFileLimit() (uint64, error) {
+	var limit unix.Rlimit
+	err := unix.Getrlimit(unix.RLIMIT_NOFILE, &limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return limit.Max, nil
+}
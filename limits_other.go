@@ -0,0 +1,9 @@
+//go:build !linux
+
+package phpnginx
+
+// openFileLimit reports an unknown open file limit on platforms other than
+// Linux.
+func openFileLimit() (uint64, error) {
+	return 0, nil
+}
@@ -0,0 +1,190 @@
+package phpnginx_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+
+	phpnginx "github.com/paketo-buildpacks/php-nginx"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testLimits(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		cgroupRoot string
+		openFiles  uint64
+	)
+
+	it.Before(func() {
+		var err error
+		cgroupRoot, err = os.MkdirTemp("", "cgroup")
+		Expect(err).NotTo(HaveOccurred())
+
+		var limit syscall.Rlimit
+		Expect(syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit)).To(Succeed())
+		openFiles = limit.Max
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(cgroupRoot)).To(Succeed())
+	})
+
+	write := func(path, content string) {
+		Expect(os.MkdirAll(filepath.Dir(filepath.Join(cgroupRoot, path)), os.ModePerm)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(cgroupRoot, path), []byte(content), 0600)).To(Succeed())
+	}
+
+	atMost := func(cpus int) int {
+		if runtime.NumCPU() < cpus {
+			return runtime.NumCPU()
+		}
+		return cpus
+	}
+
+	context("when there is no cgroup CPU controller", func() {
+		it("uses the CPUs the process may run on and the hard open file limit", func() {
+			limits, err := phpnginx.LoadContainerLimits(cgroupRoot)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(limits).To(Equal(phpnginx.ContainerLimits{
+				CPUs:      runtime.NumCPU(),
+				OpenFiles: openFiles,
+			}))
+		})
+	})
+
+	context("with cgroup v2", func() {
+		it("rounds the quota up to whole CPUs", func() {
+			write("cpu.max", "150000 100000\n")
+
+			limits, err := phpnginx.LoadContainerLimits(cgroupRoot)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(limits.CPUs).To(Equal(atMost(2)))
+		})
+
+		it("uses at least one CPU", func() {
+			write("cpu.max", "10000 100000\n")
+
+			limits, err := phpnginx.LoadContainerLimits(cgroupRoot)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(limits.CPUs).To(Equal(1))
+		})
+
+		it("ignores an unlimited quota", func() {
+			write("cpu.max", "max 100000\n")
+
+			limits, err := phpnginx.LoadContainerLimits(cgroupRoot)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(limits.CPUs).To(Equal(runtime.NumCPU()))
+		})
+
+		it("returns an error when cpu.max is malformed", func() {
+			write("cpu.max", "100000\n")
+
+			_, err := phpnginx.LoadContainerLimits(cgroupRoot)
+			Expect(err).To(MatchError(ContainSubstring(`cpu.max: "100000" is not a quota and a period`)))
+
+			write("cpu.max", "lots 100000\n")
+
+			_, err = phpnginx.LoadContainerLimits(cgroupRoot)
+			Expect(err).To(MatchError(ContainSubstring(`cpu.max: "lots" is not a positive quota`)))
+
+			write("cpu.max", "100000 0\n")
+
+			_, err = phpnginx.LoadContainerLimits(cgroupRoot)
+			Expect(err).To(MatchError(ContainSubstring(`cpu.max: "0" is not a positive period`)))
+		})
+	})
+
+	context("with cgroup v1", func() {
+		it("reads the quota from the cpu controller", func() {
+			write("cpu/cpu.cfs_quota_us", "50000\n")
+			write("cpu/cpu.cfs_period_us", "100000\n")
+
+			limits, err := phpnginx.LoadContainerLimits(cgroupRoot)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(limits.CPUs).To(Equal(1))
+		})
+
+		it("reads the quota from the combined cpu,cpuacct controller", func() {
+			write("cpu,cpuacct/cpu.cfs_quota_us", "300000\n")
+			write("cpu,cpuacct/cpu.cfs_period_us", "100000\n")
+
+			limits, err := phpnginx.LoadContainerLimits(cgroupRoot)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(limits.CPUs).To(Equal(atMost(3)))
+		})
+
+		it("ignores an unlimited quota", func() {
+			write("cpu/cpu.cfs_quota_us", "-1\n")
+			write("cpu/cpu.cfs_period_us", "100000\n")
+
+			limits, err := phpnginx.LoadContainerLimits(cgroupRoot)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(limits.CPUs).To(Equal(runtime.NumCPU()))
+		})
+
+		it("returns an error when the period is missing", func() {
+			write("cpu/cpu.cfs_quota_us", "50000\n")
+
+			_, err := phpnginx.LoadContainerLimits(cgroupRoot)
+			Expect(err).To(MatchError(ContainSubstring("failed to read")))
+			Expect(err).To(MatchError(ContainSubstring("cpu.cfs_period_us")))
+		})
+	})
+
+	context("memory limit", func() {
+		it("is unknown without a cgroup memory controller", func() {
+			limits, err := phpnginx.LoadContainerLimits(cgroupRoot)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(limits.Memory).To(BeZero())
+		})
+
+		it("reads memory.max with cgroup v2", func() {
+			write("memory.max", "536870912\n")
+
+			limits, err := phpnginx.LoadContainerLimits(cgroupRoot)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(limits.Memory).To(Equal(uint64(536870912)))
+
+			write("memory.max", "max\n")
+
+			limits, err = phpnginx.LoadContainerLimits(cgroupRoot)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(limits.Memory).To(BeZero())
+		})
+
+		it("reads memory.limit_in_bytes with cgroup v1", func() {
+			write("memory/memory.limit_in_bytes", "268435456\n")
+
+			limits, err := phpnginx.LoadContainerLimits(cgroupRoot)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(limits.Memory).To(Equal(uint64(268435456)))
+
+			write("memory/memory.limit_in_bytes", "9223372036854771712\n")
+
+			limits, err = phpnginx.LoadContainerLimits(cgroupRoot)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(limits.Memory).To(BeZero())
+		})
+
+		it("returns an error when the limit is malformed", func() {
+			write("memory.max", "lots\n")
+
+			_, err := phpnginx.LoadContainerLimits(cgroupRoot)
+			Expect(err).To(MatchError(ContainSubstring(`memory.max: "lots" is not a number of bytes`)))
+		})
+	})
+
+	context("WorkerRlimitNofile", func() {
+		it("caps very large open file limits", func() {
+			Expect(phpnginx.ContainerLimits{OpenFiles: 4096}.WorkerRlimitNofile()).To(Equal(4096))
+			Expect(phpnginx.ContainerLimits{OpenFiles: 1 << 20}.WorkerRlimitNofile()).To(Equal(65536))
+		})
+	})
+}
@@ -0,0 +1,567 @@
+package phpnginx
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+// maxIncludeDepth bounds the nesting of include directives so that
+// self-including configuration cannot recurse forever.
+const maxIncludeDepth = 16
+
+type nginxContext int
+
+const (
+	ctxMain nginxContext = 1 << iota
+	ctxEvents
+	ctxHTTP
+	ctxServer
+	ctxLocation
+	ctxUpstream
+	ctxIf
+	ctxLimitExcept
+
+	// ctxRaw marks blocks like map and types whose contents are key/value
+	// pairs rather than directives.
+	ctxRaw
+
+	// ctxUnknown marks blocks of directives this linter doesn't know about,
+	// whose contents are only checked for syntax.
+	ctxUnknown nginxContext = 0
+)
+
+type nginxDirective struct {
+	contexts nginxContext
+	isBlock  bool
+	block    nginxContext
+}
+
+func directive(contexts nginxContext) nginxDirective {
+	return nginxDirective{contexts: contexts}
+}
+
+func blockDirective(contexts, block nginxContext) nginxDirective {
+	return nginxDirective{contexts: contexts, isBlock: true, block: block}
+}
+
+const (
+	ctxHS   = ctxHTTP | ctxServer
+	ctxHSL  = ctxHTTP | ctxServer | ctxLocation
+	ctxHSLI = ctxHSL | ctxIf
+	ctxSLI  = ctxServer | ctxLocation | ctxIf
+)
+
+// nginxDirectives lists the directives of the core and commonly built
+// modules, along with the contexts they may appear in. Directives that are
+// not listed here are assumed to come from third-party modules and are not
+// checked.
+var nginxDirectives = map[string]nginxDirective{
+	// main
+	"daemon":                  directive(ctxMain),
+	"debug_points":            directive(ctxMain),
+	"env":                     directive(ctxMain),
+	"load_module":             directive(ctxMain),
+	"lock_file":               directive(ctxMain),
+	"master_process":          directive(ctxMain),
+	"pcre_jit":                directive(ctxMain),
+	"pid":                     directive(ctxMain),
+	"ssl_engine":              directive(ctxMain),
+	"thread_pool":             directive(ctxMain),
+	"timer_resolution":        directive(ctxMain),
+	"user":                    directive(ctxMain),
+	"worker_cpu_affinity":     directive(ctxMain),
+	"worker_priority":         directive(ctxMain),
+	"worker_processes":        directive(ctxMain),
+	"worker_rlimit_core":      directive(ctxMain),
+	"worker_rlimit_nofile":    directive(ctxMain),
+	"worker_shutdown_timeout": directive(ctxMain),
+	"working_directory":       directive(ctxMain),
+	"events":                  blockDirective(ctxMain, ctxEvents),
+	"http":                    blockDirective(ctxMain, ctxHTTP),
+	"mail":                    blockDirective(ctxMain, ctxUnknown),
+	"stream":                  blockDirective(ctxMain, ctxUnknown),
+	"error_log":               directive(ctxMain | ctxHSL),
+	"include":                 directive(ctxMain | ctxEvents | ctxHSLI | ctxUpstream | ctxLimitExcept),
+
+	// events
+	"accept_mutex":        directive(ctxEvents),
+	"accept_mutex_delay":  directive(ctxEvents),
+	"debug_connection":    directive(ctxEvents),
+	"multi_accept":        directive(ctxEvents),
+	"use":                 directive(ctxEvents),
+	"worker_aio_requests": directive(ctxEvents),
+	"worker_connections":  directive(ctxEvents),
+
+	// http
+	"fastcgi_cache_path":            directive(ctxHTTP),
+	"geo":                           blockDirective(ctxHTTP, ctxRaw),
+	"limit_conn_zone":               directive(ctxHTTP),
+	"limit_req_zone":                directive(ctxHTTP),
+	"log_format":                    directive(ctxHTTP),
+	"map":                           blockDirective(ctxHTTP, ctxRaw),
+	"map_hash_bucket_size":          directive(ctxHTTP),
+	"map_hash_max_size":             directive(ctxHTTP),
+	"proxy_cache_path":              directive(ctxHTTP),
+	"server":                        blockDirective(ctxHTTP, ctxServer),
+	"server_names_hash_bucket_size": directive(ctxHTTP),
+	"server_names_hash_max_size":    directive(ctxHTTP),
+	"split_clients":                 blockDirective(ctxHTTP, ctxRaw),
+	"types_hash_bucket_size":        directive(ctxHTTP),
+	"types_hash_max_size":           directive(ctxHTTP),
+	"upstream":                      blockDirective(ctxHTTP, ctxUpstream),
+	"variables_hash_bucket_size":    directive(ctxHTTP),
+	"variables_hash_max_size":       directive(ctxHTTP),
+
+	// http, server
+	"client_header_buffer_size":   directive(ctxHS),
+	"client_header_timeout":       directive(ctxHS),
+	"connection_pool_size":        directive(ctxHS),
+	"http2":                       directive(ctxHS),
+	"ignore_invalid_headers":      directive(ctxHS),
+	"large_client_header_buffers": directive(ctxHS),
+	"merge_slashes":               directive(ctxHS),
+	"request_pool_size":           directive(ctxHS),
+	"ssl_certificate":             directive(ctxHS),
+	"ssl_certificate_key":         directive(ctxHS),
+	"ssl_ciphers":                 directive(ctxHS),
+	"ssl_dhparam":                 directive(ctxHS),
+	"ssl_prefer_server_ciphers":   directive(ctxHS),
+	"ssl_protocols":               directive(ctxHS),
+	"ssl_session_cache":           directive(ctxHS),
+	"ssl_session_timeout":         directive(ctxHS),
+	"ssl_stapling":                directive(ctxHS),
+	"underscores_in_headers":      directive(ctxHS),
+
+	// server
+	"listen":      directive(ctxServer),
+	"server_name": directive(ctxServer),
+
+	// http, server, location
+	"absolute_redirect":             directive(ctxHSL),
+	"aio":                           directive(ctxHSL),
+	"auth_basic":                    directive(ctxHSL | ctxLimitExcept),
+	"auth_basic_user_file":          directive(ctxHSL | ctxLimitExcept),
+	"autoindex":                     directive(ctxHSL),
+	"allow":                         directive(ctxHSL | ctxLimitExcept),
+	"chunked_transfer_encoding":     directive(ctxHSL),
+	"client_body_buffer_size":       directive(ctxHSL),
+	"client_body_in_file_only":      directive(ctxHSL),
+	"client_body_temp_path":         directive(ctxHSL),
+	"client_body_timeout":           directive(ctxHSL),
+	"client_max_body_size":          directive(ctxHSL),
+	"default_type":                  directive(ctxHSL),
+	"deny":                          directive(ctxHSL | ctxLimitExcept),
+	"directio":                      directive(ctxHSL),
+	"etag":                          directive(ctxHSL),
+	"fastcgi_buffer_size":           directive(ctxHSL),
+	"fastcgi_buffering":             directive(ctxHSL),
+	"fastcgi_buffers":               directive(ctxHSL),
+	"fastcgi_busy_buffers_size":     directive(ctxHSL),
+	"fastcgi_cache":                 directive(ctxHSL),
+	"fastcgi_cache_key":             directive(ctxHSL),
+	"fastcgi_cache_valid":           directive(ctxHSL),
+	"fastcgi_connect_timeout":       directive(ctxHSL),
+	"fastcgi_hide_header":           directive(ctxHSL),
+	"fastcgi_ignore_headers":        directive(ctxHSL),
+	"fastcgi_index":                 directive(ctxHSL),
+	"fastcgi_intercept_errors":      directive(ctxHSL),
+	"fastcgi_keep_conn":             directive(ctxHSL),
+	"fastcgi_max_temp_file_size":    directive(ctxHSL),
+	"fastcgi_next_upstream":         directive(ctxHSL),
+	"fastcgi_param":                 directive(ctxHSL),
+	"fastcgi_pass_header":           directive(ctxHSL),
+	"fastcgi_pass_request_body":     directive(ctxHSL),
+	"fastcgi_pass_request_headers":  directive(ctxHSL),
+	"fastcgi_read_timeout":          directive(ctxHSL),
+	"fastcgi_request_buffering":     directive(ctxHSL),
+	"fastcgi_send_timeout":          directive(ctxHSL),
+	"fastcgi_temp_path":             directive(ctxHSL),
+	"gzip_buffers":                  directive(ctxHSL),
+	"gzip_comp_level":               directive(ctxHSL),
+	"gzip_disable":                  directive(ctxHSL),
+	"gzip_http_version":             directive(ctxHSL),
+	"gzip_min_length":               directive(ctxHSL),
+	"gzip_proxied":                  directive(ctxHSL),
+	"gzip_types":                    directive(ctxHSL),
+	"gzip_vary":                     directive(ctxHSL),
+	"if_modified_since":             directive(ctxHSL),
+	"index":                         directive(ctxHSL),
+	"keepalive_requests":            directive(ctxHSL | ctxUpstream),
+	"keepalive_timeout":             directive(ctxHSL | ctxUpstream),
+	"limit_conn":                    directive(ctxHSL),
+	"limit_req":                     directive(ctxHSL),
+	"lingering_close":               directive(ctxHSL),
+	"log_not_found":                 directive(ctxHSL),
+	"log_subrequest":                directive(ctxHSL),
+	"open_file_cache":               directive(ctxHSL),
+	"output_buffers":                directive(ctxHSL),
+	"port_in_redirect":              directive(ctxHSL),
+	"postpone_output":               directive(ctxHSL),
+	"proxy_buffer_size":             directive(ctxHSL),
+	"proxy_buffering":               directive(ctxHSL),
+	"proxy_buffers":                 directive(ctxHSL),
+	"proxy_cache":                   directive(ctxHSL),
+	"proxy_connect_timeout":         directive(ctxHSL),
+	"proxy_hide_header":             directive(ctxHSL),
+	"proxy_http_version":            directive(ctxHSL),
+	"proxy_read_timeout":            directive(ctxHSL),
+	"proxy_redirect":                directive(ctxHSL),
+	"proxy_send_timeout":            directive(ctxHSL),
+	"proxy_set_header":              directive(ctxHSL),
+	"proxy_temp_path":               directive(ctxHSL),
+	"real_ip_header":                directive(ctxHSL),
+	"real_ip_recursive":             directive(ctxHSL),
+	"recursive_error_pages":         directive(ctxHSL),
+	"reset_timedout_connection":     directive(ctxHSL),
+	"resolver":                      directive(ctxHSL),
+	"resolver_timeout":              directive(ctxHSL),
+	"satisfy":                       directive(ctxHSL),
+	"scgi_temp_path":                directive(ctxHSL),
+	"send_timeout":                  directive(ctxHSL),
+	"sendfile":                      directive(ctxHSLI),
+	"server_name_in_redirect":       directive(ctxHSL),
+	"server_tokens":                 directive(ctxHSL),
+	"set_real_ip_from":              directive(ctxHSL),
+	"sub_filter":                    directive(ctxHSL),
+	"subrequest_output_buffer_size": directive(ctxHSL),
+	"tcp_nodelay":                   directive(ctxHSL),
+	"tcp_nopush":                    directive(ctxHSL),
+	"types":                         blockDirective(ctxHSL, ctxRaw),
+	"uwsgi_temp_path":               directive(ctxHSL),
+
+	// http, server, location, if
+	"access_log":  directive(ctxHSLI | ctxLimitExcept),
+	"add_header":  directive(ctxHSLI),
+	"add_trailer": directive(ctxHSLI),
+	"charset":     directive(ctxHSLI),
+	"error_page":  directive(ctxHSLI),
+	"expires":     directive(ctxHSLI),
+	"gzip":        directive(ctxHSLI),
+	"limit_rate":  directive(ctxHSLI),
+	"rewrite_log": directive(ctxHSLI),
+	"root":        directive(ctxHSLI),
+	"ssi":         directive(ctxHSLI),
+
+	// server, location, if
+	"break":     directive(ctxSLI),
+	"if":        blockDirective(ctxServer|ctxLocation, ctxIf),
+	"location":  blockDirective(ctxServer|ctxLocation, ctxLocation),
+	"return":    directive(ctxSLI),
+	"rewrite":   directive(ctxSLI),
+	"set":       directive(ctxSLI),
+	"try_files": directive(ctxServer | ctxLocation),
+
+	// location
+	"alias":                   directive(ctxLocation),
+	"fastcgi_pass":            directive(ctxLocation | ctxIf),
+	"fastcgi_split_path_info": directive(ctxLocation),
+	"internal":                directive(ctxLocation),
+	"limit_except":            blockDirective(ctxLocation, ctxLimitExcept),
+	"proxy_pass":              directive(ctxLocation | ctxIf | ctxLimitExcept),
+	"stub_status":             directive(ctxServer | ctxLocation),
+
+	// upstream
+	"hash":       directive(ctxUpstream),
+	"ip_hash":    directive(ctxUpstream),
+	"keepalive":  directive(ctxUpstream),
+	"least_conn": directive(ctxUpstream),
+	"random":     directive(ctxUpstream),
+	"zone":       directive(ctxUpstream),
+}
+
+type nginxToken struct {
+	value  string
+	quoted bool
+	line   int
+}
+
+func (t nginxToken) is(value string) bool {
+	return !t.quoted && t.value == value
+}
+
+// NginxConfigLinter statically checks Nginx configuration, including the
+// files it includes, without requiring an nginx binary. It reports
+// unbalanced braces, unterminated directives and known directives used
+// outside of the contexts they are allowed in.
+type NginxConfigLinter struct {
+	logger scribe.Emitter
+}
+
+func NewNginxConfigLinter(logger scribe.Emitter) NginxConfigLinter {
+	return NginxConfigLinter{
+		logger: logger,
+	}
+}
+
+func (l NginxConfigLinter) Lint(path string) error {
+	run := lintRun{prefix: filepath.Dir(path), logger: l.logger}
+	run.lintFile(path, ctxMain, 0)
+
+	return errors.Join(run.errs...)
+}
+
+type lintRun struct {
+	prefix string
+	logger scribe.Emitter
+	errs   []error
+}
+
+func (r *lintRun) errorf(path string, line int, format string, args ...interface{}) {
+	r.errs = append(r.errs, fmt.Errorf("%s:%d: %s", path, line, fmt.Sprintf(format, args...)))
+}
+
+func (r *lintRun) lintFile(path string, context nginxContext, depth int) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		r.errs = append(r.errs, fmt.Errorf("failed to read %s: %w", path, err))
+		return
+	}
+
+	tokens, line, err := tokenizeNginxConfig(string(content))
+	if err != nil {
+		r.errorf(path, line, "%s", err)
+		return
+	}
+
+	i := 0
+	r.parseBlock(path, tokens, &i, context, nil, depth)
+}
+
+func (r *lintRun) parseBlock(path string, tokens []nginxToken, i *int, context nginxContext, open *nginxToken, depth int) {
+	for *i < len(tokens) {
+		token := tokens[*i]
+		*i++
+
+		switch {
+		case token.is("}"):
+			if open == nil {
+				r.errorf(path, token.line, `unexpected "}"`)
+				continue
+			}
+			return
+
+		case token.is(";"), token.is("{"):
+			r.errorf(path, token.line, "unexpected %q", token.value)
+			if token.is("{") {
+				r.parseBlock(path, tokens, i, ctxUnknown, &token, depth)
+			}
+			continue
+		}
+
+		var args []string
+		for *i < len(tokens) && !tokens[*i].is(";") && !tokens[*i].is("{") && !tokens[*i].is("}") {
+			args = append(args, tokens[*i].value)
+			*i++
+		}
+
+		if *i == len(tokens) {
+			r.errorf(path, token.line, `unexpected end of file, expecting ";" or "}"`)
+			return
+		}
+
+		terminator := tokens[*i]
+		*i++
+
+		switch {
+		case terminator.is(";"):
+			r.checkDirective(path, token, context, false)
+			if token.is("include") && context != ctxUnknown {
+				r.include(path, token.line, args, context, depth)
+			}
+
+		case terminator.is("{"):
+			inner := r.checkDirective(path, token, context, true)
+			r.parseBlock(path, tokens, i, inner, &token, depth)
+
+		default:
+			r.errorf(path, terminator.line, `unexpected "}"`)
+			if open != nil {
+				return
+			}
+		}
+	}
+
+	if open != nil {
+		line := open.line
+		if len(tokens) > 0 {
+			line = tokens[len(tokens)-1].line
+		}
+		r.errorf(path, line, `unexpected end of file, expecting "}" to close "%s" opened on line %d`, open.value, open.line)
+	}
+}
+
+// checkDirective validates a directive against the known directive table
+// and returns the context of its block, if it has one.
+func (r *lintRun) checkDirective(path string, token nginxToken, context nginxContext, block bool) nginxContext {
+	if context == ctxRaw || context == ctxUnknown {
+		return context
+	}
+
+	spec, ok := nginxDirectives[token.value]
+	if token.value == "server" && context == ctxUpstream {
+		spec, ok = directive(ctxUpstream), true
+	}
+	if !ok {
+		return ctxUnknown
+	}
+
+	if spec.contexts&context == 0 {
+		r.errorf(path, token.line, "%q directive is not allowed here", token.value)
+	}
+
+	switch {
+	case spec.isBlock && !block:
+		r.errorf(path, token.line, `directive %q has no opening "{"`, token.value)
+	case !spec.isBlock && block:
+		r.errorf(path, token.line, `directive %q is not terminated by ";"`, token.value)
+		return ctxUnknown
+	}
+
+	return spec.block
+}
+
+// contains reports whether path is inside the directory of the configuration
+// being linted, that is the application directory.
+func (r *lintRun) contains(path string) bool {
+	rel, err := filepath.Rel(r.prefix, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+func (r *lintRun) include(path string, line int, args []string, context nginxContext, depth int) {
+	if len(args) != 1 {
+		r.errorf(path, line, `invalid number of arguments in "include" directive`)
+		return
+	}
+
+	if depth >= maxIncludeDepth {
+		r.errorf(path, line, "include nesting is deeper than %d levels", maxIncludeDepth)
+		return
+	}
+
+	pattern := args[0]
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(r.prefix, pattern)
+	}
+
+	if !strings.ContainsAny(pattern, "*?[") {
+		_, err := os.Stat(pattern)
+		if errors.Is(err, os.ErrNotExist) && !r.contains(pattern) {
+			// Files outside of the application, such as certificates or
+			// secrets, are often only mounted into the container at launch.
+			r.logger.Subprocess(fmt.Sprintf("Warning: %s:%d: included file %q does not exist yet, it must be present at launch", path, line, pattern))
+			return
+		}
+		if err != nil {
+			r.errorf(path, line, "failed to open included file %q: %s", pattern, err)
+			return
+		}
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		r.errorf(path, line, "failed to glob %q: %s", pattern, err)
+		return
+	}
+
+	for _, match := range matches {
+		r.lintFile(match, context, depth+1)
+	}
+}
+
+// tokenizeNginxConfig splits Nginx configuration into words, quoted strings
+// and the ";", "{" and "}" punctuation. Template actions such as
+// {{env "PORT"}}, which are rendered by the nginx buildpack at launch, are
+// kept as part of the surrounding word.
+func tokenizeNginxConfig(content string) ([]nginxToken, int, error) {
+	var (
+		tokens []nginxToken
+		word   strings.Builder
+		line   = 1
+		start  = 1
+	)
+
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, nginxToken{value: word.String(), line: start})
+			word.Reset()
+		}
+	}
+
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+
+		switch {
+		case c == '\n':
+			flush()
+			line++
+
+		case c == ' ' || c == '\t' || c == '\r':
+			flush()
+
+		case c == '#' && word.Len() == 0:
+			for i < len(content) && content[i] != '\n' {
+				i++
+			}
+			i--
+
+		case c == ';' || c == '{' || c == '}':
+			if c == '{' && strings.HasPrefix(content[i:], "{{") {
+				end := strings.Index(content[i:], "}}")
+				if end < 0 {
+					return nil, line, errors.New(`unterminated template action "{{"`)
+				}
+				if word.Len() == 0 {
+					start = line
+				}
+				word.WriteString(content[i : i+end+2])
+				i += end + 1
+				continue
+			}
+
+			if c == '{' && word.Len() > 0 && strings.HasSuffix(word.String(), "$") {
+				end := strings.IndexByte(content[i:], '}')
+				if end < 0 {
+					return nil, line, errors.New(`unterminated variable "${"`)
+				}
+				word.WriteString(content[i : i+end+1])
+				i += end
+				continue
+			}
+
+			flush()
+			tokens = append(tokens, nginxToken{value: string(c), line: line})
+
+		case (c == '"' || c == '\'') && word.Len() == 0:
+			quoteLine := line
+			var value strings.Builder
+			i++
+			for ; i < len(content) && content[i] != c; i++ {
+				if content[i] == '\\' && i+1 < len(content) {
+					i++
+				}
+				if content[i] == '\n' {
+					line++
+				}
+				value.WriteByte(content[i])
+			}
+			if i == len(content) {
+				return nil, quoteLine, fmt.Errorf("unterminated quoted string starting with %c", c)
+			}
+			tokens = append(tokens, nginxToken{value: value.String(), quoted: true, line: quoteLine})
+
+		default:
+			if word.Len() == 0 {
+				start = line
+			}
+			word.WriteByte(c)
+		}
+	}
+	flush()
+
+	return tokens, line, nil
+}
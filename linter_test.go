@@ -0,0 +1,229 @@
+package phpnginx_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	phpnginx "github.com/paketo-buildpacks/php-nginx"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testLinter(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+		confPath   string
+		buffer     *bytes.Buffer
+		linter     phpnginx.NginxConfigLinter
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = os.MkdirTemp("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		confPath = filepath.Join(workingDir, "nginx.conf")
+		buffer = bytes.NewBuffer(nil)
+		linter = phpnginx.NewNginxConfigLinter(scribe.NewEmitter(buffer))
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	writeConf := func(path, content string) {
+		Expect(os.MkdirAll(filepath.Dir(path), os.ModePerm)).To(Succeed())
+		Expect(os.WriteFile(path, []byte(content), 0600)).To(Succeed())
+	}
+
+	it("accepts the configuration generated by the config writer", func() {
+		Expect(os.MkdirAll(filepath.Join(workingDir, ".nginx.conf.d"), os.ModePerm)).To(Succeed())
+		writeConf(filepath.Join(workingDir, ".nginx.conf.d", "user-server.conf"), "location /health { return 200; }\n")
+		writeConf(filepath.Join(workingDir, ".nginx.conf.d", "user-http.conf"), "map $uri $some_var { default 1; }\n")
+
+		path, err := phpnginx.NewNginxConfigWriter(scribe.NewEmitter(bytes.NewBuffer(nil))).Write(workingDir)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(linter.Lint(path)).To(Succeed())
+	})
+
+	it("accepts the configuration generated with each built-in preset", func() {
+		writer := phpnginx.NewNginxConfigWriter(scribe.NewEmitter(bytes.NewBuffer(nil)))
+		for _, name := range phpnginx.DefaultPresets().Names() {
+			Expect(os.Setenv("BP_PHP_NGINX_PRESETS", name)).To(Succeed())
+
+			path, err := writer.Write(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(linter.Lint(path)).To(Succeed(), name)
+		}
+		Expect(os.Unsetenv("BP_PHP_NGINX_PRESETS")).To(Succeed())
+	})
+
+	it("accepts template actions, variables, quoted strings and unknown directives", func() {
+		writeConf(confPath, `
+http {
+    log_format main '$remote_addr "${request}" {}';
+    server {
+        listen {{env "PORT"}} default_server;
+        more_set_headers "Server: {custom}";
+        location ~* "^/foo{2}$" {
+            some_module_block {
+                anything_goes here;
+            }
+        }
+    }
+}
+`)
+		Expect(linter.Lint(confPath)).To(Succeed())
+	})
+
+	context("when a block is not closed", func() {
+		it.Before(func() {
+			writeConf(confPath, "http {\n    server {\n        listen 8080;\n}\n")
+		})
+
+		it("returns an error", func() {
+			Expect(linter.Lint(confPath)).To(MatchError(fmt.Sprintf(`%s:4: unexpected end of file, expecting "}" to close "http" opened on line 1`, confPath)))
+		})
+	})
+
+	context("when there is an extra closing brace", func() {
+		it.Before(func() {
+			writeConf(confPath, "http {\n}\n}\n")
+		})
+
+		it("returns an error", func() {
+			Expect(linter.Lint(confPath)).To(MatchError(fmt.Sprintf(`%s:3: unexpected "}"`, confPath)))
+		})
+	})
+
+	context("when a directive is not terminated", func() {
+		it.Before(func() {
+			writeConf(confPath, "http {\n    server {\n        listen 8080\n    }\n}\n")
+		})
+
+		it("returns an error", func() {
+			Expect(linter.Lint(confPath)).To(MatchError(fmt.Sprintf(`%s:4: unexpected "}"`, confPath)))
+		})
+	})
+
+	context("when a quoted string is not terminated", func() {
+		it.Before(func() {
+			writeConf(confPath, "http {\n    add_header X-Some \"value;\n}\n")
+		})
+
+		it("returns an error", func() {
+			Expect(linter.Lint(confPath)).To(MatchError(fmt.Sprintf(`%s:2: unterminated quoted string starting with "`, confPath)))
+		})
+	})
+
+	context("when a directive is used in the wrong context", func() {
+		it.Before(func() {
+			writeConf(confPath, "http {\n    listen 8080;\n    server {\n        worker_connections 10;\n        location / { server_name foo; }\n    }\n}\n")
+		})
+
+		it("returns an error for every misplaced directive", func() {
+			err := linter.Lint(confPath)
+			Expect(err).To(MatchError(ContainSubstring(fmt.Sprintf(`%s:2: "listen" directive is not allowed here`, confPath))))
+			Expect(err).To(MatchError(ContainSubstring(fmt.Sprintf(`%s:4: "worker_connections" directive is not allowed here`, confPath))))
+			Expect(err).To(MatchError(ContainSubstring(fmt.Sprintf(`%s:5: "server_name" directive is not allowed here`, confPath))))
+		})
+	})
+
+	context("when a block directive is used without a block", func() {
+		it.Before(func() {
+			writeConf(confPath, "http {\n    server;\n    sendfile on {\n    }\n}\n")
+		})
+
+		it("returns an error", func() {
+			err := linter.Lint(confPath)
+			Expect(err).To(MatchError(ContainSubstring(fmt.Sprintf(`%s:2: directive "server" has no opening "{"`, confPath))))
+			Expect(err).To(MatchError(ContainSubstring(fmt.Sprintf(`%s:3: directive "sendfile" is not terminated by ";"`, confPath))))
+		})
+	})
+
+	context("when an upstream contains servers", func() {
+		it.Before(func() {
+			writeConf(confPath, "http {\n    upstream php_fpm {\n        server unix:/tmp/php-fpm.socket;\n    }\n}\n")
+		})
+
+		it("treats them as upstream servers", func() {
+			Expect(linter.Lint(confPath)).To(Succeed())
+		})
+	})
+
+	context("when an included file is invalid", func() {
+		var includePath string
+
+		it.Before(func() {
+			includePath = filepath.Join(workingDir, ".nginx.conf.d", "user-server.conf")
+			writeConf(includePath, "location / {\n    worker_processes 4;\n}\n")
+			writeConf(confPath, "http {\n    server {\n        include .nginx.conf.d/*-server.conf;\n    }\n}\n")
+		})
+
+		it("reports the error in the included file in the context of the include", func() {
+			Expect(linter.Lint(confPath)).To(MatchError(fmt.Sprintf(`%s:2: "worker_processes" directive is not allowed here`, includePath)))
+		})
+	})
+
+	context("when an included file has unbalanced braces", func() {
+		var includePath string
+
+		it.Before(func() {
+			includePath = filepath.Join(workingDir, "extra.conf")
+			writeConf(includePath, "}\n")
+			writeConf(confPath, "http {\n    include extra.conf;\n}\n")
+		})
+
+		it("returns an error", func() {
+			Expect(linter.Lint(confPath)).To(MatchError(fmt.Sprintf(`%s:1: unexpected "}"`, includePath)))
+		})
+	})
+
+	context("when an included file does not exist", func() {
+		it.Before(func() {
+			writeConf(confPath, "http {\n    include missing.conf;\n}\n")
+		})
+
+		it("returns an error", func() {
+			Expect(linter.Lint(confPath)).To(MatchError(ContainSubstring(fmt.Sprintf(`%s:2: failed to open included file %q`, confPath, filepath.Join(workingDir, "missing.conf")))))
+		})
+	})
+
+	context("when an included file outside of the application does not exist", func() {
+		it.Before(func() {
+			writeConf(filepath.Join(workingDir, ".nginx.conf.d", "user-server.conf"), "include /etc/nginx/secrets/tls.conf;\n")
+			writeConf(confPath, "http {\n    server {\n        include .nginx.conf.d/*-server.conf;\n    }\n}\n")
+		})
+
+		it("warns that it must be present at launch", func() {
+			Expect(linter.Lint(confPath)).To(Succeed())
+
+			Expect(buffer.String()).To(ContainSubstring(fmt.Sprintf(`Warning: %s:1: included file "/etc/nginx/secrets/tls.conf" does not exist yet, it must be present at launch`, filepath.Join(workingDir, ".nginx.conf.d", "user-server.conf"))))
+		})
+	})
+
+	context("when a file includes itself", func() {
+		it.Before(func() {
+			writeConf(confPath, "include nginx.conf;\n")
+		})
+
+		it("returns an error", func() {
+			Expect(linter.Lint(confPath)).To(MatchError(ContainSubstring("include nesting is deeper than 16 levels")))
+		})
+	})
+
+	context("when the config file cannot be read", func() {
+		it("returns an error", func() {
+			Expect(linter.Lint(confPath)).To(MatchError(ContainSubstring("failed to read")))
+		})
+	})
+}
@@ -0,0 +1,80 @@
+package phpnginx
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+const (
+	// MetricsStatusSocket is where Nginx serves its own status and FPM's to
+	// the metrics exporter.
+	MetricsStatusSocket = "/tmp/php-nginx-status.socket"
+
+	defaultMetricsPort = 9113
+)
+
+// Metrics configures the exporter that serves the metrics of Nginx and FPM
+// in the Prometheus text format. A zero value disables it.
+type Metrics struct {
+	// Port is where the exporter serves /metrics.
+	Port int
+
+	// StatusSocket is where Nginx serves its status and FPM's to the
+	// exporter.
+	StatusSocket string
+
+	// FpmStatusPath is the pm.status_path of the www pool.
+	FpmStatusPath string
+}
+
+// Enabled reports whether the metrics exporter is enabled.
+func (m Metrics) Enabled() bool {
+	return m.Port != 0
+}
+
+// Address is where the exporter listens.
+func (m Metrics) Address() string {
+	return fmt.Sprintf(":%d", m.Port)
+}
+
+// LoadMetrics returns the metrics exporter configured through
+// $BP_PHP_NGINX_ENABLE_METRICS and $BP_PHP_NGINX_METRICS_PORT. FPM's status
+// page is read from the path in status, when it is enabled, so that FPM is
+// configured with a single status path.
+func LoadMetrics(status FpmStatus) (Metrics, error) {
+	enabled := false
+	if value, ok := os.LookupEnv("BP_PHP_NGINX_ENABLE_METRICS"); ok {
+		var err error
+		enabled, err = strconv.ParseBool(value)
+		if err != nil {
+			return Metrics{}, fmt.Errorf("failed to parse $BP_PHP_NGINX_ENABLE_METRICS into boolean: %w", err)
+		}
+	}
+	if !enabled {
+		return Metrics{}, nil
+	}
+
+	metrics := Metrics{
+		Port:          defaultMetricsPort,
+		StatusSocket:  MetricsStatusSocket,
+		FpmStatusPath: defaultFpmStatusPath,
+	}
+	if status.StatusPath != "" {
+		metrics.FpmStatusPath = status.StatusPath
+	}
+
+	if value, ok := os.LookupEnv("BP_PHP_NGINX_METRICS_PORT"); ok {
+		port, err := strconv.Atoi(value)
+		if err != nil || port < 1 || port > 65535 {
+			return Metrics{}, fmt.Errorf("failed to parse $BP_PHP_NGINX_METRICS_PORT: %q is not a port number", value)
+		}
+		metrics.Port = port
+	}
+
+	if status.Port != 0 && status.Port == metrics.Port {
+		return Metrics{}, fmt.Errorf("failed to parse $BP_PHP_NGINX_METRICS_PORT: %d is already the FPM status port", metrics.Port)
+	}
+
+	return metrics, nil
+}
@@ -0,0 +1,228 @@
+package phpnginx
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Preset contributes locations, maps, headers and FastCGI parameters to the
+// generated Nginx configuration. Presets are selected by name through
+// $BP_PHP_NGINX_PRESETS or chosen automatically from the detected framework.
+type Preset interface {
+	Name() string
+	Apply(config *NginxConfig) error
+}
+
+// NginxLocation is a location block rendered into the server block. The
+// match is rendered verbatim after the location keyword (e.g. "= /robots.txt"
+// or "~* \.php$") and each directive is terminated with a semicolon.
+type NginxLocation struct {
+	Match      string
+	Directives []string
+}
+
+// Regex reports whether the location matches a regular expression. Nginx
+// checks the regular expressions nested in a prefix location before those of
+// the server, so these are repeated in the prefix locations that nest their
+// own PHP location.
+func (l NginxLocation) Regex() bool {
+	return strings.HasPrefix(l.Match, "~")
+}
+
+// NginxMap is a map block rendered into the http block, which sets Variable
+// according to the value of Source.
+type NginxMap struct {
+	Source   string
+	Variable string
+	Entries  []NginxMapEntry
+}
+
+type NginxMapEntry struct {
+	Key   string
+	Value string
+}
+
+// NginxHeader is a response header added to every response of the server.
+type NginxHeader struct {
+	Name   string
+	Value  string
+	Always bool
+}
+
+// FastCGIParam is a parameter passed to FPM along with every PHP request.
+type FastCGIParam struct {
+	Name  string
+	Value string
+}
+
+// PresetRegistry holds the presets that can be selected by name.
+type PresetRegistry map[string]Preset
+
+func NewPresetRegistry(presets ...Preset) PresetRegistry {
+	registry := PresetRegistry{}
+	for _, preset := range presets {
+		registry.Register(preset)
+	}
+
+	return registry
+}
+
+// DefaultPresets returns a registry containing the presets that ship with
+// this buildpack.
+func DefaultPresets() PresetRegistry {
+	return NewPresetRegistry(
+		DrupalPreset{},
+		LaravelPreset{},
+		SymfonyPreset{},
+		WordPressPreset{},
+	)
+}
+
+// Register adds a preset to the registry, replacing any preset with the same
+// name.
+func (r PresetRegistry) Register(preset Preset) {
+	r[preset.Name()] = preset
+}
+
+// defaultFrontController routes requests through name unless the front
+// controller was chosen through $BP_PHP_NGINX_FRONT_CONTROLLER, including
+// when it was set to an empty value to turn front controller routing off.
+func (c *NginxConfig) defaultFrontController(name string) {
+	if !c.FrontControllerSet && c.FrontController == "" {
+		c.FrontController = name
+	}
+}
+
+// Get looks up the presets with the given names, in order.
+func (r PresetRegistry) Get(names ...string) ([]Preset, error) {
+	var presets []Preset
+	for _, name := range names {
+		preset, ok := r[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown Nginx preset %q: valid presets are %v", name, r.Names())
+		}
+		presets = append(presets, preset)
+	}
+
+	return presets, nil
+}
+
+func (r PresetRegistry) Names() []string {
+	var names []string
+	for name := range r {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// LaravelPreset routes requests through Laravel's front controller and
+// applies the headers recommended by the Laravel deployment documentation.
+type LaravelPreset struct{}
+
+func (p LaravelPreset) Name() string {
+	return "laravel"
+}
+
+func (p LaravelPreset) Apply(config *NginxConfig) error {
+	config.defaultFrontController("index.php")
+
+	config.Headers = append(config.Headers,
+		NginxHeader{Name: "X-Frame-Options", Value: "SAMEORIGIN"},
+		NginxHeader{Name: "X-Content-Type-Options", Value: "nosniff"},
+	)
+
+	config.Locations = append(config.Locations,
+		NginxLocation{Match: "= /favicon.ico", Directives: []string{"access_log off", "log_not_found off"}},
+		NginxLocation{Match: "= /robots.txt", Directives: []string{"access_log off", "log_not_found off"}},
+	)
+
+	return nil
+}
+
+// SymfonyPreset routes requests through Symfony's front controller and
+// refuses to execute any other PHP script in the web directory.
+type SymfonyPreset struct{}
+
+func (p SymfonyPreset) Name() string {
+	return "symfony"
+}
+
+func (p SymfonyPreset) Apply(config *NginxConfig) error {
+	config.defaultFrontController("index.php")
+
+	// Without a front controller every script is an entry point.
+	if config.FrontController != "" {
+		config.Locations = append(config.Locations, NginxLocation{
+			Match:      fmt.Sprintf(`~* ^/(?!%s(?:/|$)).+\.php(/|$)`, regexp.QuoteMeta(config.FrontController)),
+			Directives: []string{"return 404"},
+		})
+	}
+
+	return nil
+}
+
+// WordPressPreset routes permalinks through index.php, hardens the
+// installation against common attacks and caches core static assets.
+type WordPressPreset struct{}
+
+func (p WordPressPreset) Name() string {
+	return "wordpress"
+}
+
+func (p WordPressPreset) Apply(config *NginxConfig) error {
+	config.defaultFrontController("index.php")
+
+	deny := []string{"deny all", "access_log off", "log_not_found off"}
+
+	config.Locations = append(config.Locations,
+		NginxLocation{Match: "= /xmlrpc.php", Directives: deny},
+		NginxLocation{Match: `~* /wp-config\.php$`, Directives: deny},
+		NginxLocation{Match: `~* ^/(?:readme\.html|license\.txt|wp-config-sample\.php)$`, Directives: deny},
+		NginxLocation{Match: `~* ^/wp-content/uploads/.*\.php$`, Directives: deny},
+		NginxLocation{
+			Match:      `~* ^/wp-includes/.+\.(?:css|js|gif|ico|jpe?g|png|svg|webp|woff2?)$`,
+			Directives: []string{"expires max", "access_log off"},
+		},
+	)
+
+	return nil
+}
+
+// DrupalPreset routes clean URLs through index.php, protects configuration,
+// templates and private files, and lets Drupal generate image style
+// derivatives that do not exist yet.
+type DrupalPreset struct{}
+
+func (p DrupalPreset) Name() string {
+	return "drupal"
+}
+
+func (p DrupalPreset) Apply(config *NginxConfig) error {
+	config.defaultFrontController("index.php")
+
+	deny := []string{"deny all", "access_log off", "log_not_found off"}
+
+	config.Locations = append(config.Locations,
+		NginxLocation{Match: `~* ^/sites/[^/]+/(?:files/)?private/`, Directives: deny},
+		NginxLocation{Match: `~* \.(?:yml|yaml|twig)$`, Directives: deny},
+		NginxLocation{Match: `~* ^/core/(?!(?:install|authorize)\.php(?:/|$)).*\.php(/|$)`, Directives: deny},
+	)
+
+	// Without a front controller there is no script to generate the missing
+	// files with.
+	if config.FrontController != "" {
+		fallback := []string{"try_files $uri @drupal"}
+
+		config.Locations = append(config.Locations,
+			NginxLocation{Match: `~ ^/sites/[^/]+/files/styles/`, Directives: fallback},
+			NginxLocation{Match: `~ ^(/[a-z\-]+)?/system/files/`, Directives: fallback},
+			NginxLocation{Match: "@drupal", Directives: []string{fmt.Sprintf("rewrite ^ /%s", config.FrontController)}},
+		)
+	}
+
+	return nil
+}
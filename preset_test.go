@@ -0,0 +1,204 @@
+package phpnginx_test
+
+import (
+	"testing"
+
+	phpnginx "github.com/paketo-buildpacks/php-nginx"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+type somePreset struct{}
+
+func (p somePreset) Name() string {
+	return "some-preset"
+}
+
+func (p somePreset) Apply(config *phpnginx.NginxConfig) error {
+	config.Headers = append(config.Headers, phpnginx.NginxHeader{Name: "X-Some-Header", Value: "some-value"})
+	return nil
+}
+
+func testPreset(t *testing.T, context spec.G, it spec.S) {
+	var Expect = NewWithT(t).Expect
+
+	context("PresetRegistry", func() {
+		var registry phpnginx.PresetRegistry
+
+		it.Before(func() {
+			registry = phpnginx.DefaultPresets()
+		})
+
+		it("contains the built-in presets", func() {
+			Expect(registry.Names()).To(Equal([]string{"drupal", "laravel", "symfony", "wordpress"}))
+		})
+
+		it("returns registered presets in the requested order", func() {
+			registry.Register(somePreset{})
+
+			presets, err := registry.Get("some-preset", "laravel")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(presets).To(Equal([]phpnginx.Preset{somePreset{}, phpnginx.LaravelPreset{}}))
+		})
+
+		context("failure cases", func() {
+			context("when the preset is unknown", func() {
+				it("returns an error", func() {
+					_, err := registry.Get("unknown-preset")
+					Expect(err).To(MatchError(`unknown Nginx preset "unknown-preset": valid presets are [drupal laravel symfony wordpress]`))
+				})
+			})
+		})
+	})
+
+	context("LaravelPreset", func() {
+		it("sets the front controller, headers and quiet locations", func() {
+			config := phpnginx.NginxConfig{}
+			Expect(phpnginx.LaravelPreset{}.Apply(&config)).To(Succeed())
+
+			Expect(config.FrontController).To(Equal("index.php"))
+			Expect(config.Headers).To(ContainElement(phpnginx.NginxHeader{Name: "X-Content-Type-Options", Value: "nosniff"}))
+			Expect(config.Locations).To(ContainElement(phpnginx.NginxLocation{
+				Match:      "= /robots.txt",
+				Directives: []string{"access_log off", "log_not_found off"},
+			}))
+		})
+
+		it("keeps a front controller that is already set", func() {
+			config := phpnginx.NginxConfig{FrontController: "app.php"}
+			Expect(phpnginx.LaravelPreset{}.Apply(&config)).To(Succeed())
+
+			Expect(config.FrontController).To(Equal("app.php"))
+		})
+
+		it("keeps front controller routing off when it was turned off", func() {
+			config := phpnginx.NginxConfig{FrontControllerSet: true}
+			Expect(phpnginx.LaravelPreset{}.Apply(&config)).To(Succeed())
+
+			Expect(config.FrontController).To(BeEmpty())
+		})
+	})
+
+	context("SymfonyPreset", func() {
+		it("refuses to execute PHP scripts other than the front controller", func() {
+			config := phpnginx.NginxConfig{FrontController: "app.php"}
+			Expect(phpnginx.SymfonyPreset{}.Apply(&config)).To(Succeed())
+
+			Expect(config.FrontController).To(Equal("app.php"))
+			Expect(config.Locations).To(Equal([]phpnginx.NginxLocation{
+				{
+					Match:      `~* ^/(?!app\.php(?:/|$)).+\.php(/|$)`,
+					Directives: []string{"return 404"},
+				},
+			}))
+		})
+
+		it("lets every script run when front controller routing was turned off", func() {
+			config := phpnginx.NginxConfig{FrontControllerSet: true}
+			Expect(phpnginx.SymfonyPreset{}.Apply(&config)).To(Succeed())
+
+			Expect(config.FrontController).To(BeEmpty())
+			Expect(config.Locations).To(BeEmpty())
+		})
+	})
+
+	context("WordPressPreset", func() {
+		var config phpnginx.NginxConfig
+
+		it.Before(func() {
+			config = phpnginx.NginxConfig{}
+			Expect(phpnginx.WordPressPreset{}.Apply(&config)).To(Succeed())
+		})
+
+		it("routes permalinks through index.php", func() {
+			Expect(config.FrontController).To(Equal("index.php"))
+		})
+
+		it("denies access to sensitive files", func() {
+			var denied []string
+			for _, location := range config.Locations {
+				if location.Directives[0] == "deny all" {
+					denied = append(denied, location.Match)
+				}
+			}
+
+			Expect(denied).To(Equal([]string{
+				"= /xmlrpc.php",
+				`~* /wp-config\.php$`,
+				`~* ^/(?:readme\.html|license\.txt|wp-config-sample\.php)$`,
+				`~* ^/wp-content/uploads/.*\.php$`,
+			}))
+		})
+
+		it("caches wp-includes static assets", func() {
+			Expect(config.Locations).To(ContainElement(phpnginx.NginxLocation{
+				Match:      `~* ^/wp-includes/.+\.(?:css|js|gif|ico|jpe?g|png|svg|webp|woff2?)$`,
+				Directives: []string{"expires max", "access_log off"},
+			}))
+		})
+	})
+
+	context("DrupalPreset", func() {
+		var config phpnginx.NginxConfig
+
+		it.Before(func() {
+			config = phpnginx.NginxConfig{}
+			Expect(phpnginx.DrupalPreset{}.Apply(&config)).To(Succeed())
+		})
+
+		it("routes clean URLs through index.php", func() {
+			Expect(config.FrontController).To(Equal("index.php"))
+		})
+
+		it("denies access to private files, configuration, templates and core scripts", func() {
+			var denied []string
+			for _, location := range config.Locations {
+				if location.Directives[0] == "deny all" {
+					denied = append(denied, location.Match)
+				}
+			}
+
+			Expect(denied).To(Equal([]string{
+				`~* ^/sites/[^/]+/(?:files/)?private/`,
+				`~* \.(?:yml|yaml|twig)$`,
+				`~* ^/core/(?!(?:install|authorize)\.php(?:/|$)).*\.php(/|$)`,
+			}))
+		})
+
+		it("falls back to Drupal for image style derivatives", func() {
+			Expect(config.Locations).To(ContainElements(
+				phpnginx.NginxLocation{
+					Match:      `~ ^/sites/[^/]+/files/styles/`,
+					Directives: []string{"try_files $uri @drupal"},
+				},
+				phpnginx.NginxLocation{
+					Match:      "@drupal",
+					Directives: []string{"rewrite ^ /index.php"},
+				},
+			))
+		})
+
+		context("when front controller routing is turned off", func() {
+			it.Before(func() {
+				config = phpnginx.NginxConfig{FrontControllerSet: true}
+				Expect(phpnginx.DrupalPreset{}.Apply(&config)).To(Succeed())
+			})
+
+			it("still denies access to sensitive files but does not fall back to Drupal", func() {
+				Expect(config.FrontController).To(BeEmpty())
+
+				var matches []string
+				for _, location := range config.Locations {
+					matches = append(matches, location.Match)
+				}
+
+				Expect(matches).To(Equal([]string{
+					`~* ^/sites/[^/]+/(?:files/)?private/`,
+					`~* \.(?:yml|yaml|twig)$`,
+					`~* ^/core/(?!(?:install|authorize)\.php(?:/|$)).*\.php(/|$)`,
+				}))
+			})
+		})
+	})
+}
@@ -0,0 +1,51 @@
+package phpnginx
+
+import (
+	"fmt"
+
+	"github.com/paketo-buildpacks/packit/v2"
+)
+
+// nginxCommand starts Nginx in the foreground with the generated
+// configuration. The configuration sets `daemon off`.
+const nginxCommand = `nginx -p %q -c "$PHP_NGINX_PATH"`
+
+// fpmCommand starts FPM in the foreground with the configuration set up by
+// the FPM buildpack, which includes the Nginx-specific FPM configuration.
+const fpmCommand = `php-fpm -y "$PHP_FPM_PATH" -F`
+
+// LaunchProcesses returns the processes that serve the application at launch.
+// The default "web" process runs FPM and Nginx under the launcher, unless FPM
+// runs in a separate container, in which case it only runs Nginx. The
+// "nginx" and "php-fpm" processes run a single server each, for
+// split-container deployments.
+func LaunchProcesses(workingDir string, remoteFpm bool) []packit.Process {
+	nginx := fmt.Sprintf(nginxCommand, workingDir)
+
+	web := packit.Process{
+		Type:    "web",
+		Command: LauncherExecutable,
+		Args:    []string{"-p", workingDir},
+		Direct:  true,
+		Default: true,
+	}
+	if remoteFpm {
+		web = packit.Process{
+			Type:    "web",
+			Command: nginx,
+			Default: true,
+		}
+	}
+
+	return []packit.Process{
+		web,
+		{
+			Type:    "nginx",
+			Command: nginx,
+		},
+		{
+			Type:    "php-fpm",
+			Command: fpmCommand,
+		},
+	}
+}
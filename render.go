@@ -0,0 +1,306 @@
+package phpnginx
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+// NginxConfigRenderer renders the Nginx and FPM configuration again at
+// launch, from the data saved at build-time, so that they can be sized for the
+// container and changed through $BPL_PHP_NGINX_* and $BPL_PHP_FPM_*
+// environment variables without rebuilding the image.
+type NginxConfigRenderer struct {
+	logger scribe.Emitter
+	limits ContainerLimits
+}
+
+func NewNginxConfigRenderer(logger scribe.Emitter) NginxConfigRenderer {
+	return NginxConfigRenderer{
+		logger: logger,
+	}
+}
+
+// WithContainerLimits returns a renderer that sizes the Nginx workers for
+// the given limits before applying the overrides.
+func (r NginxConfigRenderer) WithContainerLimits(limits ContainerLimits) NginxConfigRenderer {
+	r.limits = limits
+	return r
+}
+
+// Render loads the NginxConfig saved next to the build-time configuration at
+// buildPath, applies the launch-time overrides and writes the result to
+// outputPath, which may be buildPath itself, with $PORT substituted. The
+// returned error wraps fs.ErrNotExist when no configuration was saved at
+// build-time.
+func (r NginxConfigRenderer) Render(buildPath, outputPath string) error {
+	savedPath := SavedNginxConfigPath(buildPath)
+	content, err := os.ReadFile(savedPath)
+	if err != nil {
+		return fmt.Errorf("failed to read the saved Nginx configuration: %w", err)
+	}
+
+	var data NginxConfig
+	err = json.Unmarshal(content, &data)
+	if err != nil {
+		return fmt.Errorf("failed to parse the saved Nginx configuration %s: %w", savedPath, err)
+	}
+
+	r.applyLimits(&data)
+
+	err = r.applyOverrides(&data)
+	if err != nil {
+		return err
+	}
+
+	rendered, err := renderNginxConfig(data)
+	if err != nil {
+		return err
+	}
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = defaultPort
+	}
+
+	err = os.MkdirAll(filepath.Dir(outputPath), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("failed to write the Nginx configuration: %w", err)
+	}
+
+	err = os.WriteFile(outputPath, []byte(substituteLaunchActions(string(rendered), port)), 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write the Nginx configuration: %w", err)
+	}
+
+	return nil
+}
+
+// RenderFpm loads the NginxFpmConfig saved next to the build-time FPM
+// configuration at buildPath, sizes the process manager of the www pool for
+// the container's memory limit, applies the $BPL_PHP_FPM_* overrides and
+// writes the result to outputPath, which may be buildPath itself. The
+// returned error wraps fs.ErrNotExist when no configuration was saved at
+// build-time.
+func (r NginxConfigRenderer) RenderFpm(buildPath, outputPath string) error {
+	savedPath := SavedNginxConfigPath(buildPath)
+	content, err := os.ReadFile(savedPath)
+	if err != nil {
+		return fmt.Errorf("failed to read the saved FPM configuration: %w", err)
+	}
+
+	var data NginxFpmConfig
+	err = json.Unmarshal(content, &data)
+	if err != nil {
+		return fmt.Errorf("failed to parse the saved FPM configuration %s: %w", savedPath, err)
+	}
+
+	data.ProcessManager, err = r.fpmProcessManager(data.Pools)
+	if err != nil {
+		return err
+	}
+
+	rendered, err := renderNginxFpmConfig(data)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(outputPath), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("failed to write the FPM configuration: %w", err)
+	}
+
+	err = os.WriteFile(outputPath, rendered, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write the FPM configuration: %w", err)
+	}
+
+	return nil
+}
+
+// fpmProcessManager sizes the www pool so that its children, each estimated
+// to use $BPL_PHP_FPM_MEMORY_PER_CHILD, fit in the memory limit next to the
+// children of the additional pools and a reserve for everything else. It
+// returns a zero value, which keeps the base FPM settings, when the memory
+// limit is unknown and no $BPL_PHP_FPM_* override is set.
+func (r NginxConfigRenderer) fpmProcessManager(pools []FpmPool) (FpmProcessManager, error) {
+	memoryPerChild := uint64(defaultFpmMemoryPerChild)
+	if value, ok := os.LookupEnv("BPL_PHP_FPM_MEMORY_PER_CHILD"); ok {
+		var err error
+		memoryPerChild, err = parseMemorySize(value)
+		if err != nil {
+			return FpmProcessManager{}, fmt.Errorf("failed to parse $BPL_PHP_FPM_MEMORY_PER_CHILD: %w", err)
+		}
+	}
+
+	maxChildren := 0
+	if r.limits.Memory > 0 {
+		reserved := uint64(fpmReservedMemory)
+		for _, pool := range pools {
+			reserved += uint64(pool.MaxChildren) * memoryPerChild
+		}
+
+		if r.limits.Memory > reserved {
+			maxChildren = int((r.limits.Memory - reserved) / memoryPerChild)
+		}
+		if maxChildren < 1 {
+			maxChildren = 1
+		}
+
+		r.logger.Subprocess(fmt.Sprintf("FPM memory: %s limit - %s reserved = %d children of %s",
+			formatMemorySize(r.limits.Memory), formatMemorySize(reserved), maxChildren, formatMemorySize(memoryPerChild)))
+	}
+
+	overridden := false
+	positive := func(name string, target *int) error {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return nil
+		}
+
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 1 {
+			return fmt.Errorf("failed to parse $%s: %q is not a positive integer", name, value)
+		}
+		*target = number
+		overridden = true
+		return nil
+	}
+
+	err := positive("BPL_PHP_FPM_MAX_CHILDREN", &maxChildren)
+	if err != nil {
+		return FpmProcessManager{}, err
+	}
+
+	mode, modeSet := os.LookupEnv("BPL_PHP_FPM_PM")
+	if modeSet {
+		if mode != "static" && mode != "dynamic" && mode != "ondemand" {
+			return FpmProcessManager{}, fmt.Errorf("failed to parse $BPL_PHP_FPM_PM: %q is not static, dynamic or ondemand", mode)
+		}
+		overridden = true
+	}
+
+	if maxChildren == 0 {
+		maxChildren = defaultFpmMaxChildren
+	}
+
+	pm := newFpmProcessManager(maxChildren)
+	if modeSet {
+		pm.Mode = mode
+	}
+
+	err = positive("BPL_PHP_FPM_START_SERVERS", &pm.StartServers)
+	if err != nil {
+		return FpmProcessManager{}, err
+	}
+
+	err = positive("BPL_PHP_FPM_MIN_SPARE_SERVERS", &pm.MinSpareServers)
+	if err != nil {
+		return FpmProcessManager{}, err
+	}
+
+	err = positive("BPL_PHP_FPM_MAX_SPARE_SERVERS", &pm.MaxSpareServers)
+	if err != nil {
+		return FpmProcessManager{}, err
+	}
+
+	if r.limits.Memory == 0 && !overridden {
+		return FpmProcessManager{}, nil
+	}
+
+	err = pm.validate()
+	if err != nil {
+		return FpmProcessManager{}, fmt.Errorf("invalid FPM process manager settings: %w", err)
+	}
+
+	if pm.Mode == "dynamic" {
+		r.logger.Subprocess(fmt.Sprintf("FPM process manager: pm = dynamic, pm.max_children = %d, pm.start_servers = %d, pm.min_spare_servers = %d, pm.max_spare_servers = %d",
+			pm.MaxChildren, pm.StartServers, pm.MinSpareServers, pm.MaxSpareServers))
+	} else {
+		r.logger.Subprocess(fmt.Sprintf("FPM process manager: pm = %s, pm.max_children = %d", pm.Mode, pm.MaxChildren))
+	}
+
+	return pm, nil
+}
+
+// applyLimits sizes the Nginx workers for the container limits: one worker
+// per CPU, and as many connections per worker as its open file limit allows.
+func (r NginxConfigRenderer) applyLimits(data *NginxConfig) {
+	if r.limits.CPUs > 0 {
+		data.WorkerProcesses = strconv.Itoa(r.limits.CPUs)
+		r.logger.Subprocess(fmt.Sprintf("Detected %d CPUs", r.limits.CPUs))
+	}
+
+	if r.limits.OpenFiles > 0 {
+		data.WorkerRlimitNofile = r.limits.WorkerRlimitNofile()
+		data.WorkerConnections = workerConnectionsFor(data.WorkerRlimitNofile)
+		r.logger.Subprocess(fmt.Sprintf("Detected an open file limit of %d", data.WorkerRlimitNofile))
+	}
+}
+
+// applyOverrides applies the $BPL_PHP_NGINX_* environment variables that are
+// set to the configuration.
+func (r NginxConfigRenderer) applyOverrides(data *NginxConfig) error {
+	if value, ok := os.LookupEnv("BPL_PHP_NGINX_ENABLE_HTTPS"); ok {
+		enableHTTPS, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("failed to parse $BPL_PHP_NGINX_ENABLE_HTTPS into boolean: %w", err)
+		}
+		data.EnableHTTPS = enableHTTPS
+		r.logger.Subprocess(fmt.Sprintf("Enable NGINX HTTPS: %t", enableHTTPS))
+	}
+
+	if value, ok := os.LookupEnv("BPL_PHP_NGINX_ENABLE_HTTPS_REDIRECT"); ok {
+		enableHTTPSRedirect, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("failed to parse $BPL_PHP_NGINX_ENABLE_HTTPS_REDIRECT into boolean: %w", err)
+		}
+		data.DisableHTTPSRedirect = !enableHTTPSRedirect
+		r.logger.Subprocess(fmt.Sprintf("Enable HTTPS redirect: %t", enableHTTPSRedirect))
+	}
+
+	if value, ok := os.LookupEnv("BPL_PHP_NGINX_ERROR_LOG_LEVEL"); ok {
+		level, err := parseErrorLogLevel(value)
+		if err != nil {
+			return fmt.Errorf("failed to parse $BPL_PHP_NGINX_ERROR_LOG_LEVEL: %w", err)
+		}
+		data.ErrorLog.Level = level
+		r.logger.Subprocess(fmt.Sprintf("Error log level: %s", level))
+	}
+
+	if value, ok := os.LookupEnv("BPL_PHP_NGINX_WORKER_PROCESSES"); ok {
+		if value != "auto" {
+			workerProcesses, err := strconv.Atoi(value)
+			if err != nil || workerProcesses < 1 {
+				return fmt.Errorf("failed to parse $BPL_PHP_NGINX_WORKER_PROCESSES: %q is not \"auto\" or a positive integer", value)
+			}
+		}
+		data.WorkerProcesses = value
+		r.logger.Subprocess(fmt.Sprintf("Worker processes: %s", value))
+	}
+
+	if value, ok := os.LookupEnv("BPL_PHP_NGINX_WORKER_RLIMIT_NOFILE"); ok {
+		workerRlimitNofile, err := strconv.Atoi(value)
+		if err != nil || workerRlimitNofile < 1 {
+			return fmt.Errorf("failed to parse $BPL_PHP_NGINX_WORKER_RLIMIT_NOFILE: %q is not a positive integer", value)
+		}
+		data.WorkerRlimitNofile = workerRlimitNofile
+		data.WorkerConnections = workerConnectionsFor(workerRlimitNofile)
+		r.logger.Subprocess(fmt.Sprintf("Worker open file limit: %d", workerRlimitNofile))
+	}
+
+	if value, ok := os.LookupEnv("BPL_PHP_NGINX_WORKER_CONNECTIONS"); ok {
+		workerConnections, err := strconv.Atoi(value)
+		if err != nil || workerConnections < 1 {
+			return fmt.Errorf("failed to parse $BPL_PHP_NGINX_WORKER_CONNECTIONS: %q is not a positive integer", value)
+		}
+		data.WorkerConnections = workerConnections
+		r.logger.Subprocess(fmt.Sprintf("Worker connections: %d", workerConnections))
+	}
+
+	return nil
+}
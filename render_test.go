@@ -0,0 +1,438 @@
+package phpnginx_test
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	phpnginx "github.com/paketo-buildpacks/php-nginx"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testRender(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+		buildPath  string
+		outputPath string
+		buffer     *bytes.Buffer
+		renderer   phpnginx.NginxConfigRenderer
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = os.MkdirTemp("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		buffer = bytes.NewBuffer(nil)
+		logEmitter := scribe.NewEmitter(buffer)
+
+		buildPath, err = phpnginx.NewNginxConfigWriter(logEmitter).Write(workingDir)
+		Expect(err).NotTo(HaveOccurred())
+
+		outputPath = filepath.Join(workingDir, "launch", "nginx.conf")
+		renderer = phpnginx.NewNginxConfigRenderer(logEmitter)
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	it("renders the saved configuration with the port", func() {
+		Expect(renderer.Render(buildPath, outputPath)).To(Succeed())
+
+		contents, err := os.ReadFile(outputPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).To(ContainSubstring("listen       8080  default_server;"))
+		Expect(string(contents)).To(ContainSubstring("worker_processes  auto;"))
+		Expect(string(contents)).To(ContainSubstring("worker_connections  1024;"))
+		Expect(string(contents)).NotTo(ContainSubstring("worker_rlimit_nofile"))
+		Expect(string(contents)).To(ContainSubstring("map $http_x_forwarded_proto $redirect_to_https"))
+		Expect(string(contents)).NotTo(ContainSubstring("{{"))
+
+		build, err := os.ReadFile(buildPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).To(Equal(string(bytes.Replace(build, []byte(`{{env "PORT"}}`), []byte("8080"), 1))))
+	})
+
+	it("renders the configuration in place", func() {
+		Expect(renderer.Render(buildPath, buildPath)).To(Succeed())
+
+		contents, err := os.ReadFile(buildPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).To(ContainSubstring("listen       8080  default_server;"))
+
+		Expect(renderer.Render(buildPath, buildPath)).To(Succeed())
+	})
+
+	context("when the container limits are known", func() {
+		it("sizes the workers for them", func() {
+			renderer = renderer.WithContainerLimits(phpnginx.ContainerLimits{CPUs: 2, OpenFiles: 1024})
+			Expect(renderer.Render(buildPath, outputPath)).To(Succeed())
+
+			contents, err := os.ReadFile(outputPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring("worker_processes  2;"))
+			Expect(string(contents)).To(ContainSubstring("worker_rlimit_nofile  1024;"))
+			Expect(string(contents)).To(ContainSubstring("worker_connections  512;"))
+
+			Expect(buffer.String()).To(ContainSubstring("Detected 2 CPUs"))
+			Expect(buffer.String()).To(ContainSubstring("Detected an open file limit of 1024"))
+		})
+
+		it("caps the connections of large open file limits", func() {
+			renderer = renderer.WithContainerLimits(phpnginx.ContainerLimits{CPUs: 1, OpenFiles: 1 << 20})
+			Expect(renderer.Render(buildPath, outputPath)).To(Succeed())
+
+			contents, err := os.ReadFile(outputPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring("worker_processes  1;"))
+			Expect(string(contents)).To(ContainSubstring("worker_rlimit_nofile  65536;"))
+			Expect(string(contents)).To(ContainSubstring("worker_connections  4096;"))
+		})
+
+		context("when the worker settings are overridden", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BPL_PHP_NGINX_WORKER_PROCESSES", "auto")).To(Succeed())
+				Expect(os.Setenv("BPL_PHP_NGINX_WORKER_RLIMIT_NOFILE", "2000")).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BPL_PHP_NGINX_WORKER_PROCESSES")).To(Succeed())
+				Expect(os.Unsetenv("BPL_PHP_NGINX_WORKER_RLIMIT_NOFILE")).To(Succeed())
+				Expect(os.Unsetenv("BPL_PHP_NGINX_WORKER_CONNECTIONS")).To(Succeed())
+			})
+
+			it("prefers the overrides and derives the connections from the open file limit", func() {
+				renderer = renderer.WithContainerLimits(phpnginx.ContainerLimits{CPUs: 2, OpenFiles: 1024})
+				Expect(renderer.Render(buildPath, outputPath)).To(Succeed())
+
+				contents, err := os.ReadFile(outputPath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("worker_processes  auto;"))
+				Expect(string(contents)).To(ContainSubstring("worker_rlimit_nofile  2000;"))
+				Expect(string(contents)).To(ContainSubstring("worker_connections  1000;"))
+			})
+
+			it("prefers an explicit number of connections", func() {
+				Expect(os.Setenv("BPL_PHP_NGINX_WORKER_CONNECTIONS", "300")).To(Succeed())
+
+				renderer = renderer.WithContainerLimits(phpnginx.ContainerLimits{CPUs: 2, OpenFiles: 1024})
+				Expect(renderer.Render(buildPath, outputPath)).To(Succeed())
+
+				contents, err := os.ReadFile(outputPath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("worker_rlimit_nofile  2000;"))
+				Expect(string(contents)).To(ContainSubstring("worker_connections  300;"))
+			})
+		})
+	})
+
+	context("when PORT is set", func() {
+		it.Before(func() {
+			Expect(os.Setenv("PORT", "9999")).To(Succeed())
+		})
+
+		it.After(func() {
+			Expect(os.Unsetenv("PORT")).To(Succeed())
+		})
+
+		it("listens on that port", func() {
+			Expect(renderer.Render(buildPath, outputPath)).To(Succeed())
+
+			contents, err := os.ReadFile(outputPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring("listen       9999  default_server;"))
+		})
+	})
+
+	context("when launch-time overrides are set", func() {
+		it.Before(func() {
+			Expect(os.Setenv("BPL_PHP_NGINX_ENABLE_HTTPS", "true")).To(Succeed())
+			Expect(os.Setenv("BPL_PHP_NGINX_ENABLE_HTTPS_REDIRECT", "false")).To(Succeed())
+			Expect(os.Setenv("BPL_PHP_NGINX_WORKER_PROCESSES", "4")).To(Succeed())
+			Expect(os.Setenv("BPL_PHP_NGINX_WORKER_CONNECTIONS", "2048")).To(Succeed())
+			Expect(os.Setenv("BPL_PHP_NGINX_ERROR_LOG_LEVEL", "WARN")).To(Succeed())
+		})
+
+		it.After(func() {
+			Expect(os.Unsetenv("BPL_PHP_NGINX_ENABLE_HTTPS")).To(Succeed())
+			Expect(os.Unsetenv("BPL_PHP_NGINX_ENABLE_HTTPS_REDIRECT")).To(Succeed())
+			Expect(os.Unsetenv("BPL_PHP_NGINX_WORKER_PROCESSES")).To(Succeed())
+			Expect(os.Unsetenv("BPL_PHP_NGINX_WORKER_CONNECTIONS")).To(Succeed())
+			Expect(os.Unsetenv("BPL_PHP_NGINX_ERROR_LOG_LEVEL")).To(Succeed())
+		})
+
+		it("applies them", func() {
+			Expect(renderer.Render(buildPath, outputPath)).To(Succeed())
+
+			contents, err := os.ReadFile(outputPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring("listen       8080 ssl default_server;"))
+			Expect(string(contents)).NotTo(ContainSubstring("$redirect_to_https"))
+			Expect(string(contents)).To(ContainSubstring("worker_processes  4;"))
+			Expect(string(contents)).To(ContainSubstring("worker_connections  2048;"))
+			Expect(string(contents)).To(ContainSubstring("error_log  stderr  warn;"))
+
+			Expect(buffer.String()).To(ContainSubstring("Error log level: warn"))
+			Expect(buffer.String()).To(ContainSubstring("Worker processes: 4"))
+			Expect(buffer.String()).To(ContainSubstring("Worker connections: 2048"))
+		})
+	})
+
+	context("failure cases", func() {
+		context("when no configuration was saved", func() {
+			it.Before(func() {
+				Expect(os.Remove(phpnginx.SavedNginxConfigPath(buildPath))).To(Succeed())
+			})
+
+			it("returns an error that wraps fs.ErrNotExist", func() {
+				err := renderer.Render(buildPath, outputPath)
+				Expect(err).To(MatchError(ContainSubstring("failed to read the saved Nginx configuration")))
+				Expect(err).To(MatchError(fs.ErrNotExist))
+			})
+		})
+
+		context("when the saved configuration cannot be parsed", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(phpnginx.SavedNginxConfigPath(buildPath), []byte("%%%"), 0600)).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				err := renderer.Render(buildPath, outputPath)
+				Expect(err).To(MatchError(ContainSubstring("failed to parse the saved Nginx configuration")))
+			})
+		})
+
+		context("when an override is invalid", func() {
+			it.After(func() {
+				Expect(os.Unsetenv("BPL_PHP_NGINX_ENABLE_HTTPS")).To(Succeed())
+				Expect(os.Unsetenv("BPL_PHP_NGINX_ENABLE_HTTPS_REDIRECT")).To(Succeed())
+				Expect(os.Unsetenv("BPL_PHP_NGINX_WORKER_PROCESSES")).To(Succeed())
+				Expect(os.Unsetenv("BPL_PHP_NGINX_WORKER_CONNECTIONS")).To(Succeed())
+				Expect(os.Unsetenv("BPL_PHP_NGINX_ERROR_LOG_LEVEL")).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				Expect(os.Setenv("BPL_PHP_NGINX_ENABLE_HTTPS", "blah")).To(Succeed())
+				Expect(renderer.Render(buildPath, outputPath)).To(MatchError(ContainSubstring("failed to parse $BPL_PHP_NGINX_ENABLE_HTTPS into boolean:")))
+				Expect(os.Unsetenv("BPL_PHP_NGINX_ENABLE_HTTPS")).To(Succeed())
+
+				Expect(os.Setenv("BPL_PHP_NGINX_ENABLE_HTTPS_REDIRECT", "blah")).To(Succeed())
+				Expect(renderer.Render(buildPath, outputPath)).To(MatchError(ContainSubstring("failed to parse $BPL_PHP_NGINX_ENABLE_HTTPS_REDIRECT into boolean:")))
+				Expect(os.Unsetenv("BPL_PHP_NGINX_ENABLE_HTTPS_REDIRECT")).To(Succeed())
+
+				Expect(os.Setenv("BPL_PHP_NGINX_ERROR_LOG_LEVEL", "verbose")).To(Succeed())
+				Expect(renderer.Render(buildPath, outputPath)).To(MatchError(`failed to parse $BPL_PHP_NGINX_ERROR_LOG_LEVEL: "verbose" is not one of debug, info, notice, warn, error, crit, alert, emerg`))
+				Expect(os.Unsetenv("BPL_PHP_NGINX_ERROR_LOG_LEVEL")).To(Succeed())
+
+				Expect(os.Setenv("BPL_PHP_NGINX_WORKER_PROCESSES", "0")).To(Succeed())
+				Expect(renderer.Render(buildPath, outputPath)).To(MatchError(`failed to parse $BPL_PHP_NGINX_WORKER_PROCESSES: "0" is not "auto" or a positive integer`))
+				Expect(os.Unsetenv("BPL_PHP_NGINX_WORKER_PROCESSES")).To(Succeed())
+
+				Expect(os.Setenv("BPL_PHP_NGINX_WORKER_RLIMIT_NOFILE", "-1")).To(Succeed())
+				Expect(renderer.Render(buildPath, outputPath)).To(MatchError(`failed to parse $BPL_PHP_NGINX_WORKER_RLIMIT_NOFILE: "-1" is not a positive integer`))
+				Expect(os.Unsetenv("BPL_PHP_NGINX_WORKER_RLIMIT_NOFILE")).To(Succeed())
+
+				Expect(os.Setenv("BPL_PHP_NGINX_WORKER_CONNECTIONS", "lots")).To(Succeed())
+				Expect(renderer.Render(buildPath, outputPath)).To(MatchError(`failed to parse $BPL_PHP_NGINX_WORKER_CONNECTIONS: "lots" is not a positive integer`))
+			})
+		})
+
+		context("when the output cannot be written", func() {
+			it.Before(func() {
+				Expect(os.MkdirAll(filepath.Dir(outputPath), os.ModePerm)).To(Succeed())
+				Expect(os.Chmod(filepath.Dir(outputPath), 0000)).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Chmod(filepath.Dir(outputPath), os.ModePerm)).To(Succeed())
+			})
+
+			it("returns an error that wraps fs.ErrPermission", func() {
+				err := renderer.Render(buildPath, outputPath)
+				Expect(err).To(MatchError(ContainSubstring("failed to write the Nginx configuration")))
+				Expect(err).To(MatchError(fs.ErrPermission))
+			})
+		})
+	})
+
+	context("RenderFpm", func() {
+		var fpmPath string
+
+		it.Before(func() {
+			Expect(os.MkdirAll(filepath.Join(workingDir, ".php.fpm.bp"), os.ModePerm)).To(Succeed())
+
+			var err error
+			fpmPath, err = phpnginx.NewFpmNginxConfigWriter(scribe.NewEmitter(bytes.NewBuffer(nil))).Write(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		it.After(func() {
+			for _, name := range []string{"MEMORY_PER_CHILD", "PM", "MAX_CHILDREN", "START_SERVERS", "MIN_SPARE_SERVERS", "MAX_SPARE_SERVERS"} {
+				Expect(os.Unsetenv("BPL_PHP_FPM_" + name)).To(Succeed())
+			}
+		})
+
+		it("keeps the base process manager settings when the memory limit is unknown", func() {
+			Expect(renderer.RenderFpm(fpmPath, fpmPath)).To(Succeed())
+
+			contents, err := os.ReadFile(fpmPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring("[www]\n\nlisten = /tmp/php-fpm.socket\n"))
+			Expect(string(contents)).NotTo(ContainSubstring("pm ="))
+		})
+
+		it("sizes the www pool for the memory limit", func() {
+			renderer = renderer.WithContainerLimits(phpnginx.ContainerLimits{Memory: 512 << 20})
+			Expect(renderer.RenderFpm(fpmPath, fpmPath)).To(Succeed())
+
+			contents, err := os.ReadFile(fpmPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring(`[www]
+
+listen = /tmp/php-fpm.socket
+pm = dynamic
+pm.max_children = 7
+pm.start_servers = 2
+pm.min_spare_servers = 1
+pm.max_spare_servers = 3
+`))
+
+			Expect(buffer.String()).To(ContainSubstring("FPM memory: 512M limit - 64M reserved = 7 children of 64M"))
+			Expect(buffer.String()).To(ContainSubstring("FPM process manager: pm = dynamic, pm.max_children = 7, pm.start_servers = 2, pm.min_spare_servers = 1, pm.max_spare_servers = 3"))
+		})
+
+		it("uses the memory estimate per child", func() {
+			Expect(os.Setenv("BPL_PHP_FPM_MEMORY_PER_CHILD", "32m")).To(Succeed())
+
+			renderer = renderer.WithContainerLimits(phpnginx.ContainerLimits{Memory: 1 << 30})
+			Expect(renderer.RenderFpm(fpmPath, fpmPath)).To(Succeed())
+
+			contents, err := os.ReadFile(fpmPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring("pm.max_children = 30\npm.start_servers = 11\npm.min_spare_servers = 7\npm.max_spare_servers = 15\n"))
+		})
+
+		it("runs at least one child when the memory limit is tiny", func() {
+			renderer = renderer.WithContainerLimits(phpnginx.ContainerLimits{Memory: 32 << 20})
+			Expect(renderer.RenderFpm(fpmPath, fpmPath)).To(Succeed())
+
+			contents, err := os.ReadFile(fpmPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring("pm.max_children = 1\npm.start_servers = 1\npm.min_spare_servers = 1\npm.max_spare_servers = 1\n"))
+		})
+
+		context("when there are additional pools", func() {
+			it.Before(func() {
+				Expect(os.Setenv("BP_PHP_FPM_POOLS", "admin")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_FPM_POOL_ADMIN_PATH", "/admin")).To(Succeed())
+				Expect(os.Setenv("BP_PHP_FPM_POOL_ADMIN_MAX_CHILDREN", "2")).To(Succeed())
+
+				var err error
+				fpmPath, err = phpnginx.NewFpmNginxConfigWriter(scribe.NewEmitter(bytes.NewBuffer(nil))).Write(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			it.After(func() {
+				Expect(os.Unsetenv("BP_PHP_FPM_POOLS")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_FPM_POOL_ADMIN_PATH")).To(Succeed())
+				Expect(os.Unsetenv("BP_PHP_FPM_POOL_ADMIN_MAX_CHILDREN")).To(Succeed())
+			})
+
+			it("reserves memory for their children", func() {
+				renderer = renderer.WithContainerLimits(phpnginx.ContainerLimits{Memory: 512 << 20})
+				Expect(renderer.RenderFpm(fpmPath, fpmPath)).To(Succeed())
+
+				contents, err := os.ReadFile(fpmPath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("[www]\n\nlisten = /tmp/php-fpm.socket\npm = dynamic\npm.max_children = 5\n"))
+				Expect(string(contents)).To(ContainSubstring("[admin]\n\nlisten = /tmp/php-fpm-admin.socket\npm = ondemand\npm.max_children = 2\n"))
+
+				Expect(buffer.String()).To(ContainSubstring("FPM memory: 512M limit - 192M reserved = 5 children of 64M"))
+			})
+		})
+
+		context("when the process manager settings are overridden", func() {
+			it("uses a static process manager", func() {
+				Expect(os.Setenv("BPL_PHP_FPM_PM", "static")).To(Succeed())
+				Expect(os.Setenv("BPL_PHP_FPM_MAX_CHILDREN", "20")).To(Succeed())
+
+				renderer = renderer.WithContainerLimits(phpnginx.ContainerLimits{Memory: 512 << 20})
+				Expect(renderer.RenderFpm(fpmPath, fpmPath)).To(Succeed())
+
+				contents, err := os.ReadFile(fpmPath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("listen = /tmp/php-fpm.socket\npm = static\npm.max_children = 20\n\n"))
+				Expect(string(contents)).NotTo(ContainSubstring("spare"))
+				Expect(buffer.String()).To(ContainSubstring("FPM process manager: pm = static, pm.max_children = 20"))
+			})
+
+			it("derives the other settings without a memory limit", func() {
+				Expect(os.Setenv("BPL_PHP_FPM_MAX_CHILDREN", "8")).To(Succeed())
+				Expect(os.Setenv("BPL_PHP_FPM_MAX_SPARE_SERVERS", "6")).To(Succeed())
+
+				Expect(renderer.RenderFpm(fpmPath, fpmPath)).To(Succeed())
+
+				contents, err := os.ReadFile(fpmPath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("pm = dynamic\npm.max_children = 8\npm.start_servers = 3\npm.min_spare_servers = 2\npm.max_spare_servers = 6\n"))
+			})
+
+			it("uses FPM's default number of children without a memory limit", func() {
+				Expect(os.Setenv("BPL_PHP_FPM_PM", "ondemand")).To(Succeed())
+
+				Expect(renderer.RenderFpm(fpmPath, fpmPath)).To(Succeed())
+
+				contents, err := os.ReadFile(fpmPath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("pm = ondemand\npm.max_children = 5\n"))
+			})
+		})
+
+		context("failure cases", func() {
+			it("returns an error wrapping fs.ErrNotExist when no configuration was saved", func() {
+				Expect(os.Remove(phpnginx.SavedNginxConfigPath(fpmPath))).To(Succeed())
+
+				err := renderer.RenderFpm(fpmPath, fpmPath)
+				Expect(err).To(MatchError(ContainSubstring("failed to read the saved FPM configuration")))
+				Expect(err).To(MatchError(fs.ErrNotExist))
+			})
+
+			it("returns an error when an override is invalid", func() {
+				Expect(os.Setenv("BPL_PHP_FPM_MEMORY_PER_CHILD", "lots")).To(Succeed())
+				Expect(renderer.RenderFpm(fpmPath, fpmPath)).To(MatchError(`failed to parse $BPL_PHP_FPM_MEMORY_PER_CHILD: "lots" is not a size such as 64M`))
+				Expect(os.Unsetenv("BPL_PHP_FPM_MEMORY_PER_CHILD")).To(Succeed())
+
+				Expect(os.Setenv("BPL_PHP_FPM_PM", "adaptive")).To(Succeed())
+				Expect(renderer.RenderFpm(fpmPath, fpmPath)).To(MatchError(`failed to parse $BPL_PHP_FPM_PM: "adaptive" is not static, dynamic or ondemand`))
+				Expect(os.Unsetenv("BPL_PHP_FPM_PM")).To(Succeed())
+
+				Expect(os.Setenv("BPL_PHP_FPM_MAX_CHILDREN", "0")).To(Succeed())
+				Expect(renderer.RenderFpm(fpmPath, fpmPath)).To(MatchError(`failed to parse $BPL_PHP_FPM_MAX_CHILDREN: "0" is not a positive integer`))
+				Expect(os.Unsetenv("BPL_PHP_FPM_MAX_CHILDREN")).To(Succeed())
+
+				Expect(os.Setenv("BPL_PHP_FPM_START_SERVERS", "x")).To(Succeed())
+				Expect(renderer.RenderFpm(fpmPath, fpmPath)).To(MatchError(`failed to parse $BPL_PHP_FPM_START_SERVERS: "x" is not a positive integer`))
+			})
+
+			it("returns an error when the settings are inconsistent", func() {
+				Expect(os.Setenv("BPL_PHP_FPM_MIN_SPARE_SERVERS", "5")).To(Succeed())
+
+				renderer = renderer.WithContainerLimits(phpnginx.ContainerLimits{Memory: 512 << 20})
+				Expect(renderer.RenderFpm(fpmPath, fpmPath)).To(MatchError("invalid FPM process manager settings: pm.start_servers (2) must be between pm.min_spare_servers (5) and pm.max_spare_servers (3)"))
+
+				Expect(os.Unsetenv("BPL_PHP_FPM_MIN_SPARE_SERVERS")).To(Succeed())
+				Expect(os.Setenv("BPL_PHP_FPM_MAX_SPARE_SERVERS", "10")).To(Succeed())
+				Expect(os.Setenv("BPL_PHP_FPM_START_SERVERS", "8")).To(Succeed())
+				Expect(renderer.RenderFpm(fpmPath, fpmPath)).To(MatchError("invalid FPM process manager settings: pm.max_spare_servers (10) must not be greater than pm.max_children (7)"))
+			})
+		})
+	})
+}
@@ -0,0 +1,57 @@
+package phpnginx
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// defaultRequestIDHeader is the header that carries the request ID when
+// $BP_PHP_NGINX_REQUEST_ID_HEADER is not set.
+const defaultRequestIDHeader = "X-Request-ID"
+
+// requestIDVariable is the Nginx variable that holds the ID of the current
+// request, as used by the access log formats.
+const requestIDVariable = "$php_request_id"
+
+// headerNamePattern matches the header names that Nginx exposes as
+// $http_<name> variables.
+var headerNamePattern = regexp.MustCompile(`^[A-Za-z0-9]+(-[A-Za-z0-9]+)*$`)
+
+// LoadRequestIDHeader returns the header of $BP_PHP_NGINX_REQUEST_ID_HEADER,
+// which carries the request ID in both requests and responses.
+func LoadRequestIDHeader() (string, error) {
+	header, ok := os.LookupEnv("BP_PHP_NGINX_REQUEST_ID_HEADER")
+	if !ok {
+		return defaultRequestIDHeader, nil
+	}
+
+	header = strings.TrimSpace(header)
+	if !headerNamePattern.MatchString(header) {
+		return "", fmt.Errorf("failed to parse $BP_PHP_NGINX_REQUEST_ID_HEADER: %q is not a header name, such as X-Request-ID", header)
+	}
+
+	return header, nil
+}
+
+// addRequestID gives every request an ID: the one in header, when the client
+// or a proxy in front of Nginx sent one, or the one Nginx generates
+// otherwise. The ID is returned in header and passed to FPM as the
+// HTTP_<HEADER> parameter, where PHP finds it in $_SERVER whether or not it
+// was sent.
+func addRequestID(config *NginxConfig, header string) {
+	name := strings.ToLower(strings.ReplaceAll(header, "-", "_"))
+
+	config.Maps = append(config.Maps, NginxMap{
+		Source:   "$http_" + name,
+		Variable: requestIDVariable,
+		Entries: []NginxMapEntry{
+			{Key: "default", Value: "$http_" + name},
+			{Key: `""`, Value: "$request_id"},
+		},
+	})
+
+	config.Headers = append(config.Headers, NginxHeader{Name: header, Value: requestIDVariable, Always: true})
+	config.FastCGIParams = append(config.FastCGIParams, FastCGIParam{Name: "HTTP_" + strings.ToUpper(name), Value: requestIDVariable})
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 
 	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/packit/v2/pexec"
 	"github.com/paketo-buildpacks/packit/v2/scribe"
 	phpnginx "github.com/paketo-buildpacks/php-nginx"
 )
@@ -12,9 +13,11 @@ func main() {
 	logEmitter := scribe.NewEmitter(os.Stdout).WithLevel(os.Getenv("BP_LOG_LEVEL"))
 	nginxConfigWriter := phpnginx.NewNginxConfigWriter(logEmitter)
 	nginxFpmConfigWriter := phpnginx.NewFpmNginxConfigWriter(logEmitter)
+	configLinter := phpnginx.NewNginxConfigLinter(logEmitter)
+	configValidator := phpnginx.NewNginxConfigValidator(pexec.NewExecutable("nginx"), logEmitter)
 
 	packit.Run(
 		phpnginx.Detect(),
-		phpnginx.Build(nginxConfigWriter, nginxFpmConfigWriter, logEmitter),
+		phpnginx.Build(nginxConfigWriter, nginxFpmConfigWriter, configLinter, configValidator, logEmitter),
 	)
 }
@@ -0,0 +1,50 @@
+package phpnginx
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// traceIDVariable is the Nginx variable that holds the trace ID of the
+// current request's traceparent header, or is empty when it has none.
+const traceIDVariable = "$php_trace_id"
+
+// LoadTraceContext reports whether W3C trace context propagation is enabled
+// through $BP_PHP_NGINX_ENABLE_TRACE_CONTEXT.
+func LoadTraceContext() (bool, error) {
+	value, ok := os.LookupEnv("BP_PHP_NGINX_ENABLE_TRACE_CONTEXT")
+	if !ok {
+		return false, nil
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse $BP_PHP_NGINX_ENABLE_TRACE_CONTEXT into boolean: %w", err)
+	}
+
+	return enabled, nil
+}
+
+// addTraceContext passes the traceparent and tracestate headers to FPM as
+// they were received, and extracts the trace ID from traceparent for the
+// access log. A traceparent that is not
+// <version>-<trace-id>-<parent-id>-<flags>, or whose trace ID is all zeros,
+// which the W3C Trace Context specification makes invalid, leaves the trace
+// ID empty.
+func addTraceContext(config *NginxConfig) {
+	config.Maps = append(config.Maps, NginxMap{
+		Source:   "$http_traceparent",
+		Variable: traceIDVariable,
+		Entries: []NginxMapEntry{
+			{Key: "default", Value: `""`},
+			{Key: quoteMapKey("~^[0-9a-f]{2}-0{32}-"), Value: `""`},
+			{Key: quoteMapKey("~^(?!ff)[0-9a-f]{2}-([0-9a-f]{32})-[0-9a-f]{16}-[0-9a-f]{2}(-|$)"), Value: "$1"},
+		},
+	})
+
+	config.FastCGIParams = append(config.FastCGIParams,
+		FastCGIParam{Name: "HTTP_TRACEPARENT", Value: "$http_traceparent if_not_empty"},
+		FastCGIParam{Name: "HTTP_TRACESTATE", Value: "$http_tracestate if_not_empty"},
+	)
+}
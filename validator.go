@@ -0,0 +1,110 @@
+package phpnginx
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2/pexec"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+//go:generate faux --interface Executable --output fakes/executable.go
+
+// Executable runs a command, such as nginx, with a set of arguments.
+type Executable interface {
+	Execute(pexec.Execution) error
+}
+
+// defaultPort stands in for $PORT when it is not set, e.g. when the
+// configuration is validated at build-time.
+const defaultPort = "8080"
+
+var (
+	envTemplateAction  = regexp.MustCompile(`\{\{\s*env\s+"([^"]+)"\s*\}\}`)
+	portTemplateAction = regexp.MustCompile(`\{\{\s*port\s*\}\}`)
+)
+
+// NginxConfigValidator validates a rendered Nginx configuration by running
+// `nginx -t` against it.
+type NginxConfigValidator struct {
+	nginx  Executable
+	logger scribe.Emitter
+}
+
+func NewNginxConfigValidator(nginx Executable, logger scribe.Emitter) NginxConfigValidator {
+	return NginxConfigValidator{
+		nginx:  nginx,
+		logger: logger,
+	}
+}
+
+// Validate substitutes the launch-time template actions in the configuration
+// at path, then runs `nginx -t` against the result with workingDir as the
+// Nginx prefix. Any diagnostics printed by nginx are included in the
+// returned error.
+func (v NginxConfigValidator) Validate(workingDir, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = defaultPort
+	}
+
+	rendered := substituteLaunchActions(string(content), port)
+
+	// The rendered copy is placed next to the original so that relative
+	// include paths resolve the same way.
+	file, err := os.CreateTemp(filepath.Dir(path), ".nginx-validate-*.conf")
+	if err != nil {
+		return fmt.Errorf("failed to create configuration for validation: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString(rendered)
+	if err != nil {
+		return fmt.Errorf("failed to write configuration for validation: %w", err)
+	}
+
+	err = file.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write configuration for validation: %w", err)
+	}
+
+	args := []string{"-t", "-p", workingDir, "-c", file.Name()}
+	v.logger.Debug.Subprocess(fmt.Sprintf("Running 'nginx %s'", strings.Join(args, " ")))
+
+	buffer := bytes.NewBuffer(nil)
+	err = v.nginx.Execute(pexec.Execution{
+		Args:   args,
+		Stdout: buffer,
+		Stderr: buffer,
+	})
+	output := strings.ReplaceAll(buffer.String(), file.Name(), path)
+	if err != nil {
+		return fmt.Errorf("nginx rejected the configuration: %w\n%s", err, strings.TrimSpace(output))
+	}
+	v.logger.Debug.Action("%s", strings.TrimSpace(output))
+
+	return nil
+}
+
+// substituteLaunchActions replaces the template actions that are otherwise
+// rendered at launch, {{env "NAME"}} and {{port}}, with the value of the
+// environment variable and port respectively.
+func substituteLaunchActions(content, port string) string {
+	rendered := portTemplateAction.ReplaceAllString(content, port)
+	return envTemplateAction.ReplaceAllStringFunc(rendered, func(action string) string {
+		name := envTemplateAction.FindStringSubmatch(action)[1]
+		if name == "PORT" {
+			return port
+		}
+		return os.Getenv(name)
+	})
+}
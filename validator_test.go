@@ -0,0 +1,124 @@
+package phpnginx_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paketo-buildpacks/packit/v2/pexec"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	phpnginx "github.com/paketo-buildpacks/php-nginx"
+	"github.com/paketo-buildpacks/php-nginx/fakes"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testValidator(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+		confPath   string
+		nginx      *fakes.Executable
+		rendered   string
+		validator  phpnginx.NginxConfigValidator
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = os.MkdirTemp("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		confPath = filepath.Join(workingDir, "nginx.conf")
+		Expect(os.WriteFile(confPath, []byte(`listen {{env "PORT"}} default_server; root {{ env "SOME_ROOT" }}; port {{port}};`), 0600)).To(Succeed())
+
+		Expect(os.Setenv("SOME_ROOT", "/some/root")).To(Succeed())
+
+		nginx = &fakes.Executable{}
+		nginx.ExecuteCall.Stub = func(execution pexec.Execution) error {
+			content, err := os.ReadFile(execution.Args[len(execution.Args)-1])
+			if err != nil {
+				return err
+			}
+			rendered = string(content)
+
+			fmt.Fprintf(execution.Stderr, "nginx: configuration file %s test is successful\n", execution.Args[len(execution.Args)-1])
+			return nil
+		}
+
+		validator = phpnginx.NewNginxConfigValidator(nginx, scribe.NewEmitter(bytes.NewBuffer(nil)))
+	})
+
+	it.After(func() {
+		Expect(os.Unsetenv("SOME_ROOT")).To(Succeed())
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	it("runs nginx -t against the config with template actions substituted", func() {
+		Expect(validator.Validate(workingDir, confPath)).To(Succeed())
+
+		args := nginx.ExecuteCall.Receives.Execution.Args
+		Expect(args[:4]).To(Equal([]string{"-t", "-p", workingDir, "-c"}))
+		Expect(filepath.Dir(args[4])).To(Equal(workingDir))
+		Expect(args[4]).NotTo(BeAnExistingFile())
+
+		Expect(rendered).To(Equal(`listen 8080 default_server; root /some/root; port 8080;`))
+	})
+
+	context("when $PORT is set", func() {
+		it.Before(func() {
+			Expect(os.Setenv("PORT", "9090")).To(Succeed())
+		})
+
+		it.After(func() {
+			Expect(os.Unsetenv("PORT")).To(Succeed())
+		})
+
+		it("uses it in place of the port", func() {
+			Expect(validator.Validate(workingDir, confPath)).To(Succeed())
+			Expect(rendered).To(Equal(`listen 9090 default_server; root /some/root; port 9090;`))
+		})
+	})
+
+	context("failure cases", func() {
+		context("when nginx rejects the config", func() {
+			it.Before(func() {
+				nginx.ExecuteCall.Stub = func(execution pexec.Execution) error {
+					fmt.Fprintf(execution.Stderr, "nginx: [emerg] unknown directive \"foo\" in %s:1\n", execution.Args[len(execution.Args)-1])
+					return errors.New("exit status 1")
+				}
+			})
+
+			it("returns an error with nginx's diagnostics", func() {
+				err := validator.Validate(workingDir, confPath)
+				Expect(err).To(MatchError(fmt.Sprintf("nginx rejected the configuration: exit status 1\nnginx: [emerg] unknown directive \"foo\" in %s:1", confPath)))
+			})
+		})
+
+		context("when the config cannot be read", func() {
+			it("returns an error", func() {
+				err := validator.Validate(workingDir, filepath.Join(workingDir, "missing.conf"))
+				Expect(err).To(MatchError(ContainSubstring("failed to read")))
+			})
+		})
+
+		context("when the validation copy cannot be created", func() {
+			it.Before(func() {
+				Expect(os.Chmod(workingDir, 0500)).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Chmod(workingDir, os.ModePerm)).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				err := validator.Validate(workingDir, confPath)
+				Expect(err).To(MatchError(ContainSubstring("failed to create configuration for validation")))
+			})
+		})
+	})
+}